@@ -0,0 +1,112 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// AuthMode selects how credentials are sent to a device
+type AuthMode int
+
+const (
+	// AuthAuto probes the modes below in order until the device accepts
+	// one, and remembers it. A SOAP sent on its own with AuthAuto behaves
+	// like AuthBoth.
+	AuthAuto AuthMode = iota
+	// AuthWSSecurityDigest sends a WS-UsernameToken with a PasswordDigest
+	AuthWSSecurityDigest
+	// AuthHTTPDigest answers HTTP Digest or Basic challenges only. The
+	// challenge is cached so following requests are authorized upfront.
+	AuthHTTPDigest
+	// AuthBoth sends a WS-UsernameToken digest and answers HTTP challenges
+	AuthBoth
+	// AuthWSSecurityText sends a WS-UsernameToken with a PasswordText
+	AuthWSSecurityText
+)
+
+// autoAuthModes are the modes probed by AuthAuto, in order
+var autoAuthModes = []AuthMode{AuthWSSecurityDigest, AuthHTTPDigest, AuthBoth, AuthWSSecurityText}
+
+func (mode AuthMode) String() string {
+	switch mode {
+	case AuthAuto:
+		return "Auto"
+	case AuthWSSecurityDigest:
+		return "WSSecurityDigest"
+	case AuthHTTPDigest:
+		return "HTTPDigest"
+	case AuthBoth:
+		return "Both"
+	case AuthWSSecurityText:
+		return "WSSecurityText"
+	}
+	return "Unknown"
+}
+
+// usesWSSecurity reports whether a WS-UsernameToken is sent in this mode
+func (mode AuthMode) usesWSSecurity() bool {
+	return mode != AuthHTTPDigest
+}
+
+// usesHTTP reports whether HTTP challenges are answered in this mode
+func (mode AuthMode) usesHTTP() bool {
+	return mode == AuthAuto || mode == AuthHTTPDigest || mode == AuthBoth
+}
+
+// deviceAuthMode remembers the mode accepted by a device in AuthAuto
+type deviceAuthMode struct {
+	mu   sync.Mutex
+	mode AuthMode
+}
+
+// EffectiveAuthMode returns the authentication mode used for the device: its
+// AuthMode, or the mode found by probing when AuthMode is AuthAuto. AuthAuto
+// is returned while no request was accepted yet.
+func (device *Device) EffectiveAuthMode() AuthMode {
+	if device.AuthMode != AuthAuto {
+		return device.AuthMode
+	}
+
+	negotiated := &device.state().authMode
+	negotiated.mu.Lock()
+	defer negotiated.mu.Unlock()
+
+	return negotiated.mode
+}
+
+// sendAuthenticated sends soap with the device's authentication mode,
+// probing the supported modes when it is AuthAuto
+func (device *Device) sendAuthenticated(ctx context.Context, soap SOAP, xaddr string) ([]byte, error) {
+	mode := device.EffectiveAuthMode()
+	if mode != AuthAuto {
+		soap.AuthMode = mode
+		return device.sendWithClockSync(ctx, soap, xaddr)
+	}
+
+	var err error
+	for _, mode := range autoAuthModes {
+		soap.AuthMode = mode
+
+		var response []byte
+		response, err = device.sendWithClockSync(ctx, soap, xaddr)
+		if errors.Is(err, ErrNotAuthorized) {
+			Debugf("%s refused authentication mode %s", xaddr, mode)
+			continue
+		}
+
+		// Any answer from the device other than an authentication
+		// failure means the credentials went through
+		var fault *Fault
+		if err == nil || errors.As(err, &fault) {
+			negotiated := &device.state().authMode
+			negotiated.mu.Lock()
+			negotiated.mode = mode
+			negotiated.mu.Unlock()
+		}
+
+		return response, err
+	}
+
+	return nil, err
+}
@@ -0,0 +1,59 @@
+package onvif
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthAutoProbing(t *testing.T) {
+	requests := 0
+
+	// The camera only accepts HTTP authentication without WS-Security
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if strings.Contains(string(body), "GetSystemDateAndTime") {
+			w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetSystemDateAndTimeResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><SystemDateAndTime/></GetSystemDateAndTimeResponse></s:Body></s:Envelope>`))
+			return
+		}
+
+		user, password, ok := r.BasicAuth()
+		if strings.Contains(string(body), "UsernameToken") || !ok || user != "admin" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="cam"`)
+			w.WriteHeader(401)
+			return
+		}
+
+		w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetHostnameResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><HostnameInformation><Name>cam</Name></HostnameInformation></GetHostnameResponse>
+</s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	device := Device{XAddr: server.URL, User: "admin", Password: "secret"}
+
+	hostname, err := device.GetHostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostname.Name != "cam" {
+		t.Errorf("unexpected hostname %+v", hostname)
+	}
+	if mode := device.EffectiveAuthMode(); mode != AuthHTTPDigest {
+		t.Errorf("expected %s to be negotiated, got %s", AuthHTTPDigest, mode)
+	}
+
+	// The negotiated mode and cached challenge are reused
+	requests = 0
+	if _, err = device.GetHostname(); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("expected a single request once negotiated, got %d", requests)
+	}
+}
@@ -0,0 +1,144 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the HTTP timeout used when ClientOptions does not set one,
+// and the time ProbeHost waits for an answer when its context has no deadline
+const DefaultTimeout = 5 * time.Second
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+// ClientOptions contains the HTTP settings used to communicate with a device
+type ClientOptions struct {
+	// HTTPClient is used as is when set, Transport and Timeout are then ignored
+	HTTPClient *http.Client
+	// Transport sends the HTTP requests, http.DefaultTransport when nil
+	Transport http.RoundTripper
+	// Timeout limits a single HTTP exchange, DefaultTimeout when zero
+	Timeout time.Duration
+}
+
+// httpClient returns the HTTP client described by the options
+func (opts ClientOptions) httpClient() *http.Client {
+	if opts.HTTPClient != nil {
+		return opts.HTTPClient
+	}
+
+	if opts.Transport == nil && opts.Timeout == 0 {
+		return defaultHTTPClient
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &http.Client{
+		Transport: opts.Transport,
+		Timeout:   timeout,
+	}
+}
+
+// deviceState is the connection state shared by all copies of a Device
+type deviceState struct {
+	auth     httpAuth
+	clock    deviceClock
+	authMode deviceAuthMode
+	services deviceServices
+}
+
+// stateMutex guards the lazy creation of Device.connState
+var stateMutex sync.Mutex
+
+// state returns the connection state of the device, creating it on first use
+func (device *Device) state() *deviceState {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	if device.connState == nil {
+		device.connState = &deviceState{}
+	}
+	return device.connState
+}
+
+// sendSOAP sends soap to xaddr using its client, or the device's client
+// options when it has none, and the device's authentication mode. The
+// response body is decoded into response unless it is nil.
+func (device *Device) sendSOAP(ctx context.Context, soap SOAP, xaddr string, response interface{}) error {
+	if soap.Client == nil {
+		soap.Client = device.Client.httpClient()
+	}
+	soap.auth = &device.state().auth
+
+	var body []byte
+	var err error
+	if soap.User == "" {
+		body, err = soap.send(ctx, xaddr)
+	} else {
+		body, err = device.sendAuthenticated(ctx, soap, xaddr)
+	}
+	if err != nil || response == nil {
+		return err
+	}
+
+	return decodeResponse(body, response)
+}
+
+// sendWithClockSync sends soap with its WS-UsernameToken adjusted to the
+// device clock
+func (device *Device) sendWithClockSync(ctx context.Context, soap SOAP, xaddr string) ([]byte, error) {
+	if !soap.AuthMode.usesWSSecurity() {
+		return soap.send(ctx, xaddr)
+	}
+
+	soap.TokenAge = device.tokenAge(ctx)
+	response, err := soap.send(ctx, xaddr)
+	if !errors.Is(err, ErrNotAuthorized) {
+		return response, err
+	}
+
+	// The camera clock may have drifted since it was measured, retry
+	// when resynchronizing it changes the skew
+	skew, syncErr := device.SyncClockWithContext(ctx)
+	if syncErr != nil || absDuration(skew-soap.TokenAge) < clockSkewTolerance {
+		return nil, err
+	}
+
+	soap.TokenAge = skew
+	return soap.send(ctx, xaddr)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// httpGet downloads uri with the device's client options, answering an
+// authentication challenge with the device's credentials
+func (device *Device) httpGet(ctx context.Context, uri string) ([]byte, error) {
+	urlURI, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, body, err := device.state().auth.do(ctx, device.Client.httpClient(), "GET", urlURI.String(), nil, nil, device.User, device.Password, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("GET %s: %s", uri, resp.Status)
+	}
+
+	return body, nil
+}
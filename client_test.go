@@ -0,0 +1,45 @@
+package onvif
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientOptionsTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl">
+<s:Body><tds:GetDeviceInformationResponse>
+<tds:Manufacturer>ACME</tds:Manufacturer>
+<tds:Model>Q5</tds:Model>
+</tds:GetDeviceInformationResponse></s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	device := Device{
+		XAddr:  server.URL + "/onvif/device_service",
+		Client: ClientOptions{Transport: transport},
+	}
+
+	info, err := device.GetInformation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Manufacturer != "ACME" || info.Model != "Q5" {
+		t.Errorf("unexpected device information %+v", info)
+	}
+	if transport.requests != 1 {
+		t.Errorf("expected 1 request through the transport, got %d", transport.requests)
+	}
+}
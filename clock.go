@@ -0,0 +1,128 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// clockSkewTolerance is the change of skew under which a request refused
+// with NotAuthorized is not retried after resynchronizing the clock
+const clockSkewTolerance = time.Second
+
+// clockSyncRetryInterval is the time after a failed measure of the clock
+// skew before a request measures it again
+const clockSyncRetryInterval = time.Minute
+
+// deviceClock tracks the offset between the camera clock and ours
+type deviceClock struct {
+	mu     sync.Mutex
+	synced bool
+	skew   time.Duration
+	// failed is the time of the last failed measure
+	failed time.Time
+}
+
+// ClockSkew returns the offset between the camera UTC clock and the local
+// clock measured by the last SyncClock, positive when the camera is ahead.
+// The offset is applied to the Created time of every WS-UsernameToken.
+func (device *Device) ClockSkew() time.Duration {
+	clock := &device.state().clock
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	return clock.skew
+}
+
+// SyncClock measures the camera clock skew with an unauthenticated
+// GetSystemDateAndTime request
+func (device *Device) SyncClock() (time.Duration, error) {
+	return device.SyncClockWithContext(context.Background())
+}
+
+// SyncClockWithContext is the context-aware variant of SyncClock.
+func (device *Device) SyncClockWithContext(ctx context.Context) (time.Duration, error) {
+	// Create SOAP, the request is sent without credentials as it must be
+	// answered by devices whatever their clock
+	soap := SOAP{
+		Request: getSystemDateAndTime{},
+		Client:  device.Client.httpClient(),
+	}
+
+	// Send SOAP request
+	sent := time.Now()
+	body, err := soap.send(ctx, device.XAddr)
+	if err != nil {
+		return 0, err
+	}
+	received := time.Now()
+
+	var response getSystemDateAndTimeResponse
+	if err = decodeResponse(body, &response); err != nil {
+		return 0, err
+	}
+
+	dateAndTime, err := response.systemDateAndTime()
+	if err != nil {
+		return 0, err
+	}
+
+	cameraTime, err := dateAndTime.UTCDateTime.toTime()
+	if err != nil {
+		return 0, err
+	}
+
+	// Compare with the local time halfway through the exchange
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := cameraTime.Sub(local).Round(time.Second)
+
+	clock := &device.state().clock
+	clock.mu.Lock()
+	clock.synced = true
+	clock.skew = skew
+	clock.mu.Unlock()
+
+	Debugf("clock skew of %s is %s", device.XAddr, skew)
+
+	return skew, nil
+}
+
+// tokenAge returns the skew to apply to WS-UsernameToken, measuring it on
+// first contact with the device. A failed measure is retried after
+// clockSyncRetryInterval, meanwhile no skew is applied.
+func (device *Device) tokenAge(ctx context.Context) time.Duration {
+	clock := &device.state().clock
+	clock.mu.Lock()
+	synced, skew, failed := clock.synced, clock.skew, clock.failed
+	clock.mu.Unlock()
+
+	if synced || time.Since(failed) < clockSyncRetryInterval {
+		return skew
+	}
+
+	skew, err := device.SyncClockWithContext(ctx)
+	if err != nil {
+		Warnf("could not measure clock skew of %s: %v", device.XAddr, err)
+
+		// Do not try again on every request, unless the measure was only
+		// cut short by the caller
+		if ctx.Err() == nil {
+			clock.mu.Lock()
+			clock.failed = time.Now()
+			clock.mu.Unlock()
+		}
+	}
+
+	return skew
+}
+
+// toTime converts an ONVIF DateTime to a time in UTC
+func (dateTime DateTime) toTime() (time.Time, error) {
+	if dateTime.Date.Year == 0 {
+		return time.Time{}, errors.New("device did not return its UTC date and time")
+	}
+
+	return time.Date(dateTime.Date.Year, time.Month(dateTime.Date.Month), dateTime.Date.Day,
+		dateTime.Time.Hour, dateTime.Time.Minute, dateTime.Time.Second, 0, time.UTC), nil
+}
@@ -0,0 +1,114 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestClockSkewCompensation(t *testing.T) {
+	cameraOffset := time.Hour
+	createdPattern := regexp.MustCompile(`<Created[^>]*>([^<]+)</Created>`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		now := time.Now().Add(cameraOffset).UTC()
+
+		if regexp.MustCompile(`GetSystemDateAndTime`).Match(body) {
+			fmt.Fprintf(w, `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetSystemDateAndTimeResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><SystemDateAndTime><DateTimeType>Manual</DateTimeType>
+<UTCDateTime><Time><Hour>%d</Hour><Minute>%d</Minute><Second>%d</Second></Time>
+<Date><Year>%d</Year><Month>%d</Month><Day>%d</Day></Date></UTCDateTime>
+</SystemDateAndTime></GetSystemDateAndTimeResponse></s:Body></s:Envelope>`,
+				now.Hour(), now.Minute(), now.Second(), now.Year(), now.Month(), now.Day())
+			return
+		}
+
+		match := createdPattern.FindSubmatch(body)
+		if match == nil {
+			t.Errorf("request has no WS-UsernameToken: %s", body)
+			return
+		}
+		created, _ := time.Parse(time.RFC3339, string(match[1]))
+		if absDuration(created.Sub(now)) > 5*time.Second {
+			w.WriteHeader(400)
+			w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body><s:Fault>
+<s:Code><s:Value>s:Sender</s:Value><s:Subcode><s:Value>ter:NotAuthorized</s:Value></s:Subcode></s:Code>
+<s:Reason><s:Text>Sender not authorized</s:Text></s:Reason></s:Fault></s:Body></s:Envelope>`))
+			return
+		}
+
+		w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetHostnameResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><HostnameInformation><Name>cam</Name></HostnameInformation></GetHostnameResponse>
+</s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	device := Device{XAddr: server.URL, User: "admin", Password: "admin"}
+
+	if _, err := device.GetHostname(); err != nil {
+		t.Fatal(err)
+	}
+	if skew := device.ClockSkew(); absDuration(skew-cameraOffset) > 2*time.Second {
+		t.Errorf("unexpected clock skew %s", skew)
+	}
+
+	// The camera clock jumps, the auth fault must trigger a resync
+	cameraOffset = -time.Hour
+	if _, err := device.GetHostname(); err != nil {
+		t.Fatal(err)
+	}
+	if skew := device.ClockSkew(); absDuration(skew-cameraOffset) > 2*time.Second {
+		t.Errorf("clock skew was not resynchronized, got %s", skew)
+	}
+}
+
+func TestTokenAgeRetry(t *testing.T) {
+	available := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		now := time.Now().Add(time.Hour).UTC()
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetSystemDateAndTimeResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><SystemDateAndTime><DateTimeType>Manual</DateTimeType>
+<UTCDateTime><Time><Hour>%d</Hour><Minute>%d</Minute><Second>%d</Second></Time>
+<Date><Year>%d</Year><Month>%d</Month><Day>%d</Day></Date></UTCDateTime>
+</SystemDateAndTime></GetSystemDateAndTimeResponse></s:Body></s:Envelope>`,
+			now.Hour(), now.Minute(), now.Second(), now.Year(), now.Month(), now.Day())
+	}))
+	defer server.Close()
+
+	device := Device{XAddr: server.URL}
+
+	// A cancelled measure does not delay the next one
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if skew := device.tokenAge(ctx); skew != 0 {
+		t.Errorf("unexpected skew %s", skew)
+	}
+
+	// A failed measure is not retried right away
+	if skew := device.tokenAge(context.Background()); skew != 0 {
+		t.Errorf("unexpected skew %s", skew)
+	}
+	available = true
+	if skew := device.tokenAge(context.Background()); skew != 0 {
+		t.Errorf("skew was measured again right after a failure, got %s", skew)
+	}
+
+	// It is once clockSyncRetryInterval elapsed
+	clock := &device.state().clock
+	clock.mu.Lock()
+	clock.failed = clock.failed.Add(-clockSyncRetryInterval)
+	clock.mu.Unlock()
+	if skew := device.tokenAge(context.Background()); absDuration(skew-time.Hour) > 2*time.Second {
+		t.Errorf("unexpected skew %s", skew)
+	}
+}
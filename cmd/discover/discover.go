@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,75 +14,98 @@ import (
 )
 
 func main() {
-
-	ifaces, err := net.Interfaces()
-	if err != nil {
-		panic(err)
+	interfaces := flag.String("interfaces", "", "comma-separated names or indexes of the interfaces to probe, all when empty")
+	allow := flag.String("allow", "", "comma-separated networks to probe from, in CIDR notation")
+	deny := flag.String("deny", "172.17.0.0/16", "comma-separated networks not to probe from, in CIDR notation")
+	ttl := flag.Int("ttl", 0, "multicast TTL of the probes, the system default when 0")
+	repeat := flag.Int("repeat", 0, "retransmissions of each probe, the WS-Discovery default when 0")
+	flag.Parse()
+
+	options := DiscoveryOptions{TTL: *ttl, Repeat: *repeat}
+	for _, iface := range splitList(*interfaces) {
+		if index, err := strconv.Atoi(iface); err == nil {
+			options.InterfaceIndexes = append(options.InterfaceIndexes, index)
+		} else {
+			options.InterfaceNames = append(options.InterfaceNames, iface)
+		}
 	}
+	options.AllowNetworks = parseNetworks(*allow)
+	options.DenyNetworks = parseNetworks(*deny)
 
-	var addrs []net.Addr
+	var devices []*Device
 
-	for _, iface := range ifaces {
-		if strings.Contains(iface.Name, "en") || strings.Contains(iface.Name, "wlp") || strings.Contains(iface.Name, "wlan") || strings.Contains(iface.Name, "br0") || strings.Contains(iface.Name, "enx") {
-			ifaceAddrs, err := iface.Addrs()
+	for len(devices) == 0 {
+		fmt.Println("Discovering...")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 
-			if err != nil {
-				panic(err)
-			}
+		// Cameras are listed as soon as they answer, and queried once the
+		// discovery is over so a slow camera does not hold up the others
+		for d := range StreamDiscoveryWithOptions(ctx, nil, options) {
+			Info("Found", d.XAddr)
+			devices = append(devices, d)
+		}
+		cancel()
 
-			addrs = append(addrs, ifaceAddrs...)
+		if len(devices) == 0 {
+			fmt.Println("No cameras were found")
+			time.Sleep(1 * time.Second)
 		}
 	}
 
-	if len(addrs) == 0 {
-		fmt.Println("No addresses")
-		return
+	for _, d := range devices {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		showDevice(ctx, d)
+		cancel()
 	}
+}
 
-	var found = 0
-
-	for found == 0 {
-		time.Sleep(1 * time.Second)
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
-		fmt.Println("Discovering...")
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
-		defer cancel()
-		d, err := StartDiscoveryWithContext(ctx, addrs, time.Second*15)
+func parseNetworks(list string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range splitList(list) {
+		_, network, err := net.ParseCIDR(cidr)
 		if err != nil {
 			panic(err)
 		}
+		networks = append(networks, network)
+	}
+	return networks
+}
 
-		found = len(d)
-		fmt.Println(found)
-
-		if len(d) == 0 {
-			fmt.Println("No cameras were found")
-			continue
-		}
-
-		for i := 0; i < found; i++ {
-			Info("XAddr", d[i].XAddr)
+func showDevice(ctx context.Context, d *Device) {
+	Info("XAddr", d.XAddr)
 
-			d[i].User = "admin"
-			d[i].Password = "admin"
-			nps, err := d[i].GetNetworkProtocols()
-			if err != nil {
-				Error(err)
-			}
-			parsed, _ := url.Parse(d[i].XAddr)
-			host, _, _ := net.SplitHostPort(parsed.Host)
+	d.User = "admin"
+	d.Password = "admin"
+	nps, err := d.GetNetworkProtocolsWithContext(ctx)
+	if err != nil {
+		Error(err)
+	}
+	parsed, _ := url.Parse(d.XAddr)
+	host, _, _ := net.SplitHostPort(parsed.Host)
 
-			for _, np := range nps {
-				fmt.Println("Joined", net.JoinHostPort(host, fmt.Sprintf("%d", np.Port)))
-			}
+	for _, np := range nps {
+		fmt.Println("Joined", net.JoinHostPort(host, fmt.Sprintf("%d", np.Port)))
+	}
 
-			profiles, _ := d[i].GetProfiles()
-			for _, p := range profiles {
-				fmt.Println(d[i].GetStreamURI(p.Token, "UDP"))
-				fmt.Println(d[i].GetStreamURI(p.Token, "RTSP"))
-				fmt.Println(d[i].GetStreamURI(p.Token, "HTTP"))
-				fmt.Println(d[i].GetSnapshotURI(p.Token))
-			}
-		}
+	profiles, err := d.GetProfilesWithContext(ctx)
+	if err != nil {
+		Error(err)
+		return
+	}
+	for _, p := range profiles {
+		fmt.Println(d.GetStreamURIWithContext(ctx, p.Token, "UDP"))
+		fmt.Println(d.GetStreamURIWithContext(ctx, p.Token, "RTSP"))
+		fmt.Println(d.GetStreamURIWithContext(ctx, p.Token, "HTTP"))
+		fmt.Println(d.GetSnapshotURIWithContext(ctx, p.Token))
 	}
 }
@@ -1,118 +1,103 @@
 package onvif
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
-var deviceXMLNs = []string{
-	`xmlns:tds="http://www.onvif.org/ver10/device/wsdl"`,
-	`xmlns:tt="http://www.onvif.org/ver10/schema"`,
-}
-
 // GetInformation fetch information of ONVIF camera
 func (device *Device) GetInformation() (DeviceInformation, error) {
+	return device.GetInformationWithContext(context.Background())
+}
+
+// GetInformationWithContext is the context-aware variant of GetInformation.
+func (device *Device) GetInformationWithContext(ctx context.Context) (DeviceInformation, error) {
 	// Create SOAP
 	soap := SOAP{
-		Body:     "<tds:GetDeviceInformation/>",
-		XMLNs:    deviceXMLNs,
+		Request:  getDeviceInformation{},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
-	if err != nil {
-		return DeviceInformation{}, err
-	}
-
-	// Parse response to interface
-	deviceInfo, err := response.ValueForPath("Envelope.Body.GetDeviceInformationResponse")
+	var response getDeviceInformationResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
 	if err != nil {
 		return DeviceInformation{}, err
 	}
 
-	// Parse interface to struct
-	result := DeviceInformation{}
-	if mapInfo, ok := deviceInfo.(map[string]interface{}); ok {
-		result.Manufacturer = interfaceToString(mapInfo["Manufacturer"])
-		result.Model = interfaceToString(mapInfo["Model"])
-		result.FirmwareVersion = interfaceToString(mapInfo["FirmwareVersion"])
-		result.SerialNumber = interfaceToString(mapInfo["SerialNumber"])
-		result.HardwareID = interfaceToString(mapInfo["HardwareId"])
-	}
-
-	return result, nil
+	return DeviceInformation{
+		Manufacturer:    response.Manufacturer,
+		Model:           response.Model,
+		FirmwareVersion: response.FirmwareVersion,
+		SerialNumber:    response.SerialNumber,
+		HardwareID:      response.HardwareID,
+	}, nil
 }
 
 // GetCapabilities fetch info of ONVIF camera's capabilities
 func (device *Device) GetCapabilities() (DeviceCapabilities, error) {
+	return device.GetCapabilitiesWithContext(context.Background())
+}
+
+// GetCapabilitiesWithContext is the context-aware variant of GetCapabilities.
+func (device *Device) GetCapabilitiesWithContext(ctx context.Context) (DeviceCapabilities, error) {
 	// Create SOAP
 	soap := SOAP{
-		XMLNs: deviceXMLNs,
-		Body: `<tds:GetCapabilities>
-			<tds:Category>All</tds:Category>
-		</tds:GetCapabilities>`,
+		Request:  getCapabilities{Category: "All"},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	var response getCapabilitiesResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
 	if err != nil {
 		return DeviceCapabilities{}, err
 	}
+	capabilities := response.Capabilities
 
 	// Get network capabilities
-	envelopeBodyPath := "Envelope.Body.GetCapabilitiesResponse.Capabilities"
-	ifaceNetCap, err := response.ValueForPath(envelopeBodyPath + ".Device.Network")
-	if err != nil {
-		return DeviceCapabilities{}, err
+	if capabilities.Device == nil || capabilities.Device.Network == nil {
+		return DeviceCapabilities{}, errMissing("GetCapabilities", "Device.Network")
 	}
 
-	netCap := NetworkCapabilities{}
-	if mapNetCap, ok := ifaceNetCap.(map[string]interface{}); ok {
-		netCap.DynDNS = interfaceToBool(mapNetCap["DynDNS"])
-		netCap.IPFilter = interfaceToBool(mapNetCap["IPFilter"])
-		netCap.IPVersion6 = interfaceToBool(mapNetCap["IPVersion6"])
-		netCap.ZeroConfig = interfaceToBool(mapNetCap["ZeroConfiguration"])
+	netCap := NetworkCapabilities{
+		DynDNS:     capabilities.Device.Network.DynDNS,
+		IPFilter:   capabilities.Device.Network.IPFilter,
+		IPVersion6: capabilities.Device.Network.IPVersion6,
+		ZeroConfig: capabilities.Device.Network.ZeroConfiguration,
 	}
 
 	// Get events capabilities
-	ifaceEventsCap, err := response.ValueForPath(envelopeBodyPath + ".Events")
+	if capabilities.Events == nil {
+		return DeviceCapabilities{}, errMissing("GetCapabilities", "Events")
+	}
+
+	eventsCap, err := parseCapabilityFlags(capabilities.Events.Flags, func(key string) string {
+		return strings.Replace(key, "WS", "", 1)
+	})
 	if err != nil {
 		return DeviceCapabilities{}, err
 	}
 
-	eventsCap := make(map[string]bool)
-	if mapEventsCap, ok := ifaceEventsCap.(map[string]interface{}); ok {
-		for key, value := range mapEventsCap {
-			if strings.ToLower(key) == "xaddr" {
-				continue
-			}
-
-			key = strings.Replace(key, "WS", "", 1)
-			eventsCap[key] = interfaceToBool(value)
-		}
+	// Get streaming capabilities
+	if capabilities.Media == nil || capabilities.Media.StreamingCapabilities == nil {
+		return DeviceCapabilities{}, errMissing("GetCapabilities", "Media.StreamingCapabilities")
 	}
 
-	// Get streaming capabilities
-	ifaceStreamingCap, err := response.ValueForPath(envelopeBodyPath + ".Media.StreamingCapabilities")
+	streamingCap, err := parseCapabilityFlags(capabilities.Media.StreamingCapabilities.Flags, func(key string) string {
+		return strings.Replace(key, "_", " ", -1)
+	})
 	if err != nil {
 		return DeviceCapabilities{}, err
 	}
 
-	streamingCap := make(map[string]bool)
-	if mapStreamingCap, ok := ifaceStreamingCap.(map[string]interface{}); ok {
-		for key, value := range mapStreamingCap {
-			key = strings.Replace(key, "_", " ", -1)
-			streamingCap[key] = interfaceToBool(value)
-		}
-	}
-
 	// Create final result
 	deviceCapabilities := DeviceCapabilities{
 		Network:   netCap,
@@ -123,241 +108,515 @@ func (device *Device) GetCapabilities() (DeviceCapabilities, error) {
 	return deviceCapabilities, nil
 }
 
+// parseCapabilityFlags converts boolean capabilities to a map keyed by their
+// element name, renamed by rename. XAddr and Extension are skipped.
+func parseCapabilityFlags(flags []capabilityFlag, rename func(string) string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	for _, flag := range flags {
+		key := flag.XMLName.Local
+		if key == "XAddr" || key == "Extension" {
+			continue
+		}
+
+		value, err := strconv.ParseBool(strings.TrimSpace(flag.Value))
+		if err != nil {
+			return nil, fmt.Errorf("%w: capability %s: %v", ErrInvalidResponse, key, err)
+		}
+		result[rename(key)] = value
+	}
+
+	return result, nil
+}
+
 // GetDiscoveryMode fetch network discovery mode of an ONVIF camera
-func (device *Device) GetDiscoveryMode() (string, error) {
+func (device *Device) GetDiscoveryMode() (DiscoveryMode, error) {
+	return device.GetDiscoveryModeWithContext(context.Background())
+}
+
+// GetDiscoveryModeWithContext is the context-aware variant of GetDiscoveryMode.
+func (device *Device) GetDiscoveryModeWithContext(ctx context.Context) (DiscoveryMode, error) {
 	// Create SOAP
 	soap := SOAP{
-		Body:     "<tds:GetDiscoveryMode/>",
-		XMLNs:    deviceXMLNs,
+		Request:  getDiscoveryMode{},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	var response getDiscoveryModeResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
 	if err != nil {
 		return "", err
 	}
 
-	// Parse response
-	discoveryMode, _ := response.ValueForPathString("Envelope.Body.GetDiscoveryModeResponse.DiscoveryMode")
-	return discoveryMode, nil
+	if response.DiscoveryMode == "" {
+		return "", errMissing("GetDiscoveryMode", "DiscoveryMode")
+	}
+	return response.DiscoveryMode, nil
 }
 
-// GetScopes fetch scopes of an ONVIF camera
-func (device *Device) GetScopes() ([]string, error) {
+// SetDiscoveryMode sets whether an ONVIF camera answers WS-Discovery probes
+// on its local network
+func (device *Device) SetDiscoveryMode(mode DiscoveryMode) error {
+	return device.SetDiscoveryModeWithContext(context.Background(), mode)
+}
+
+// SetDiscoveryModeWithContext is the context-aware variant of SetDiscoveryMode.
+func (device *Device) SetDiscoveryModeWithContext(ctx context.Context, mode DiscoveryMode) error {
+	// Create SOAP
+	soap := SOAP{
+		Request:  setDiscoveryMode{DiscoveryMode: mode},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	return device.sendSOAP(ctx, soap, device.XAddr, nil)
+}
+
+// GetRemoteDiscoveryMode fetch whether an ONVIF camera announces itself to
+// its discovery proxies
+func (device *Device) GetRemoteDiscoveryMode() (DiscoveryMode, error) {
+	return device.GetRemoteDiscoveryModeWithContext(context.Background())
+}
+
+// GetRemoteDiscoveryModeWithContext is the context-aware variant of GetRemoteDiscoveryMode.
+func (device *Device) GetRemoteDiscoveryModeWithContext(ctx context.Context) (DiscoveryMode, error) {
 	// Create SOAP
 	soap := SOAP{
-		Body:     "<tds:GetScopes/>",
-		XMLNs:    deviceXMLNs,
+		Request:  getRemoteDiscoveryMode{},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	var response getRemoteDiscoveryModeResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
+	if err != nil {
+		return "", err
+	}
+
+	if response.RemoteDiscoveryMode == "" {
+		return "", errMissing("GetRemoteDiscoveryMode", "RemoteDiscoveryMode")
+	}
+	return response.RemoteDiscoveryMode, nil
+}
+
+// SetRemoteDiscoveryMode sets whether an ONVIF camera announces itself to
+// its discovery proxies
+func (device *Device) SetRemoteDiscoveryMode(mode DiscoveryMode) error {
+	return device.SetRemoteDiscoveryModeWithContext(context.Background(), mode)
+}
+
+// SetRemoteDiscoveryModeWithContext is the context-aware variant of SetRemoteDiscoveryMode.
+func (device *Device) SetRemoteDiscoveryModeWithContext(ctx context.Context, mode DiscoveryMode) error {
+	// Create SOAP
+	soap := SOAP{
+		Request:  setRemoteDiscoveryMode{RemoteDiscoveryMode: mode},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	return device.sendSOAP(ctx, soap, device.XAddr, nil)
+}
+
+// GetDPAddresses fetch the discovery proxy addresses of an ONVIF camera
+func (device *Device) GetDPAddresses() ([]NetworkHost, error) {
+	return device.GetDPAddressesWithContext(context.Background())
+}
+
+// GetDPAddressesWithContext is the context-aware variant of GetDPAddresses.
+func (device *Device) GetDPAddressesWithContext(ctx context.Context) ([]NetworkHost, error) {
+	// Create SOAP
+	soap := SOAP{
+		Request:  getDPAddresses{},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	var response getDPAddressesResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse response to interface
-	ifaceScopes, err := response.ValuesForPath("Envelope.Body.GetScopesResponse.Scopes")
+	return append([]NetworkHost{}, response.DPAddress...), nil
+}
+
+// SetDPAddresses sets the discovery proxy addresses of an ONVIF camera. An
+// empty list removes them.
+func (device *Device) SetDPAddresses(addresses []NetworkHost) error {
+	return device.SetDPAddressesWithContext(context.Background(), addresses)
+}
+
+// SetDPAddressesWithContext is the context-aware variant of SetDPAddresses.
+func (device *Device) SetDPAddressesWithContext(ctx context.Context, addresses []NetworkHost) error {
+	dpAddresses := []networkHostRequest{}
+	for _, address := range addresses {
+		dpAddresses = append(dpAddresses, networkHostRequest{
+			Type:        address.Type,
+			IPv4Address: address.IPv4Address,
+			IPv6Address: address.IPv6Address,
+			DNSname:     address.DNSname,
+		})
+	}
+
+	// Create SOAP
+	soap := SOAP{
+		Request:  setDPAddresses{DPAddress: dpAddresses},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	return device.sendSOAP(ctx, soap, device.XAddr, nil)
+}
+
+// GetScopes fetch scopes of an ONVIF camera, and updates Scopes and
+// ParsedScopes of the device
+func (device *Device) GetScopes() ([]string, error) {
+	return device.GetScopesWithContext(context.Background())
+}
+
+// GetScopesWithContext is the context-aware variant of GetScopes.
+func (device *Device) GetScopesWithContext(ctx context.Context) ([]string, error) {
+	definitions, err := device.GetScopeDefinitionsWithContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert interface to array of scope
 	scopes := []string{}
-	for _, ifaceScope := range ifaceScopes {
-		if mapScope, ok := ifaceScope.(map[string]interface{}); ok {
-			scope := interfaceToString(mapScope["ScopeItem"])
-			scopes = append(scopes, scope)
+	for _, scope := range definitions {
+		scopes = append(scopes, scope.Item)
+	}
+	return scopes, nil
+}
+
+// GetScopeDefinitions fetch scopes of an ONVIF camera with their definition,
+// and updates Scopes and ParsedScopes of the device
+func (device *Device) GetScopeDefinitions() ([]Scope, error) {
+	return device.GetScopeDefinitionsWithContext(context.Background())
+}
+
+// GetScopeDefinitionsWithContext is the context-aware variant of GetScopeDefinitions.
+func (device *Device) GetScopeDefinitionsWithContext(ctx context.Context) ([]Scope, error) {
+	// Create SOAP
+	soap := SOAP{
+		Request:  getScopes{},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	var response getScopesResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []Scope{}
+	items := []string{}
+	for _, scope := range response.Scopes {
+		if scope.ScopeItem == "" {
+			return nil, errMissing("GetScopes", "ScopeItem")
 		}
+		scopes = append(scopes, Scope{
+			Definition: ScopeDefinition(strings.TrimSpace(scope.ScopeDef)),
+			Item:       strings.TrimSpace(scope.ScopeItem),
+		})
+		items = append(items, strings.TrimSpace(scope.ScopeItem))
 	}
 
+	device.setScopes(items)
 	return scopes, nil
 }
 
-// GetHostname fetch hostname of an ONVIF camera
-func (device *Device) GetHostname() (HostnameInformation, error) {
+// SetScopes replaces the configurable scopes of an ONVIF camera. Fixed
+// scopes are kept by the camera.
+func (device *Device) SetScopes(scopes []string) error {
+	return device.SetScopesWithContext(context.Background(), scopes)
+}
+
+// SetScopesWithContext is the context-aware variant of SetScopes.
+func (device *Device) SetScopesWithContext(ctx context.Context, scopes []string) error {
 	// Create SOAP
 	soap := SOAP{
-		Body:     "<tds:GetHostname/>",
-		XMLNs:    deviceXMLNs,
+		Request:  setScopes{Scopes: scopes},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	return device.sendSOAP(ctx, soap, device.XAddr, nil)
+}
+
+// AddScopes adds configurable scopes to an ONVIF camera. ErrTooManyScopes is
+// matched when the camera can not hold more scopes.
+func (device *Device) AddScopes(scopes []string) error {
+	return device.AddScopesWithContext(context.Background(), scopes)
+}
+
+// AddScopesWithContext is the context-aware variant of AddScopes.
+func (device *Device) AddScopesWithContext(ctx context.Context, scopes []string) error {
+	// Create SOAP
+	soap := SOAP{
+		Request:  addScopes{ScopeItem: scopes},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	return device.sendSOAP(ctx, soap, device.XAddr, nil)
+}
+
+// RemoveScopes removes configurable scopes of an ONVIF camera and returns
+// the scopes removed. Nothing is removed and ErrFixedScope is returned when
+// one of the scopes is fixed.
+func (device *Device) RemoveScopes(scopes []string) ([]string, error) {
+	return device.RemoveScopesWithContext(context.Background(), scopes)
+}
+
+// RemoveScopesWithContext is the context-aware variant of RemoveScopes.
+func (device *Device) RemoveScopesWithContext(ctx context.Context, scopes []string) ([]string, error) {
+	current, err := device.GetScopeDefinitionsWithContext(ctx)
 	if err != nil {
-		return HostnameInformation{}, err
+		return nil, err
+	}
+	for _, scope := range current {
+		if scope.Definition == ScopeFixed && containsString(scopes, scope.Item) {
+			return nil, fmt.Errorf("%w: %s", ErrFixedScope, scope.Item)
+		}
 	}
 
-	// Parse response to interface
-	ifaceHostInfo, err := response.ValueForPath("Envelope.Body.GetHostnameResponse.HostnameInformation")
+	// Create SOAP
+	soap := SOAP{
+		Request:  removeScopes{ScopeItem: scopes},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	var response removeScopesResponse
+	err = device.sendSOAP(ctx, soap, device.XAddr, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, scope := range response.ScopeItem {
+		removed = append(removed, strings.TrimSpace(scope))
+	}
+	return removed, nil
+}
+
+// GetHostname fetch hostname of an ONVIF camera
+func (device *Device) GetHostname() (HostnameInformation, error) {
+	return device.GetHostnameWithContext(context.Background())
+}
+
+// GetHostnameWithContext is the context-aware variant of GetHostname.
+func (device *Device) GetHostnameWithContext(ctx context.Context) (HostnameInformation, error) {
+	// Create SOAP
+	soap := SOAP{
+		Request:  getHostname{},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	var response getHostnameResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
 	if err != nil {
 		return HostnameInformation{}, err
 	}
 
-	// Parse interface to struct
-	hostnameInfo := HostnameInformation{}
-	if mapHostInfo, ok := ifaceHostInfo.(map[string]interface{}); ok {
-		hostnameInfo.Name = interfaceToString(mapHostInfo["Name"])
-		hostnameInfo.FromDHCP = interfaceToBool(mapHostInfo["FromDHCP"])
+	if response.HostnameInformation == nil {
+		return HostnameInformation{}, errMissing("GetHostname", "HostnameInformation")
 	}
 
-	return hostnameInfo, nil
+	return HostnameInformation{
+		Name:     response.HostnameInformation.Name,
+		FromDHCP: response.HostnameInformation.FromDHCP,
+	}, nil
 }
 
 // GetNetworkInterfaces fetches the Network Interfaces of an ONVIF camera
 func (device *Device) GetNetworkInterfaces() (NetworkInterfaces, error) {
+	return device.GetNetworkInterfacesWithContext(context.Background())
+}
+
+// GetNetworkInterfacesWithContext is the context-aware variant of GetNetworkInterfaces.
+func (device *Device) GetNetworkInterfacesWithContext(ctx context.Context) (NetworkInterfaces, error) {
 	// Create SOAP
 	soap := SOAP{
-		Body:     "<tds:GetNetworkInterfaces/>",
-		XMLNs:    deviceXMLNs,
+		Request:  getNetworkInterfaces{},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	var response getNetworkInterfacesResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
 	if err != nil {
 		return NetworkInterfaces{}, err
 	}
 
-	// Parse response to interface
-	networkInfo, err := response.ValueForPath("Envelope.Body.GetNetworkInterfacesResponse.NetworkInterfaces")
+	if len(response.NetworkInterfaces) == 0 {
+		return NetworkInterfaces{}, errMissing("GetNetworkInterfaces", "NetworkInterfaces")
+	}
+
+	return response.NetworkInterfaces[0], nil
+}
+
+// GetServices fetches the services of an ONVIF camera and their address
+func (device *Device) GetServices() (services []Service, err error) {
+	return device.GetServicesWithContext(context.Background())
+}
+
+// GetServicesWithContext is the context-aware variant of GetServices.
+func (device *Device) GetServicesWithContext(ctx context.Context) (services []Service, err error) {
+	services, err = device.getServices(ctx)
 	if err != nil {
-		return NetworkInterfaces{}, err
+		return
 	}
 
-	networkInfoAsJSON, _ := json.MarshalIndent(networkInfo, "", "  ")
-	var ni NetworkInterfaces
-	if err = json.Unmarshal(networkInfoAsJSON, &ni); err != nil {
-		return NetworkInterfaces{}, err
+	_services := make(map[string]Service)
+	for _, service := range services {
+		_services[service.NameSpace] = service
+	}
+
+	// An empty list is not kept, so serviceXAddr fetches it again
+	lock := &device.state().services
+	lock.mu.Lock()
+	if len(_services) > 0 {
+		device.Services = _services
+		lock.capabilities = false
 	}
+	lock.mu.Unlock()
 
-	return ni, nil
+	return
 }
 
-// GetNetworkInterfaces fetches the Network Interfaces of an ONVIF camera
-func (device *Device) GetServices() (services []Service, err error) {
+// getServices sends GetServices, without updating Device.Services
+func (device *Device) getServices(ctx context.Context) (services []Service, err error) {
 	// Create SOAP
 	soap := SOAP{
-		Body: `<tds:GetServices xmlns:ns0="http://www.onvif.org/ver10/device/wsdl">
-			<ns0:IncludeCapability>false</ns0:IncludeCapability>
-		</tds:GetServices>`,
-		XMLNs:    deviceXMLNs,
+		Request:  getServices{IncludeCapability: false},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
-	if err != nil {
-		return
-	}
-
-	// Parse response to interface
-	servicesInfo, err := response.ValuesForPath("Envelope.Body.GetServicesResponse.Service")
+	var response getServicesResponse
+	err = device.sendSOAP(ctx, soap, device.XAddr, &response)
 	if err != nil {
 		return
 	}
 
-	_services := make(map[string]Service)
-	for _, svc := range servicesInfo {
-		if mapService, ok := svc.(map[string]interface{}); ok {
-			newService := Service{
-				NameSpace: mapService["Namespace"].(string),
-				XAddr:     mapService["XAddr"].(string),
-			}
-			_services[newService.NameSpace] = newService
-			services = append(services, newService)
+	for _, service := range response.Service {
+		if service.Namespace == "" || service.XAddr == "" {
+			return nil, errMissing("GetServices", "Service Namespace or XAddr")
 		}
+
+		services = append(services, Service{
+			NameSpace: strings.TrimSpace(service.Namespace),
+			XAddr:     strings.TrimSpace(service.XAddr),
+			Version:   service.Version,
+		})
 	}
-	device.Services = _services
 
 	return
 }
 
 func (device *Device) SetNTP(ntpServer string) error {
-	var soap SOAP
+	return device.SetNTPWithContext(context.Background(), ntpServer)
+}
+
+// SetNTPWithContext is the context-aware variant of SetNTP.
+func (device *Device) SetNTPWithContext(ctx context.Context, ntpServer string) error {
 	// Create SOAP
+	ntpManual := networkHostRequest{Type: "DNS", DNSname: ntpServer}
 
 	re := regexp.MustCompile(`^[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.([0-9]{1,3})$`)
 	r := re.FindStringSubmatch(ntpServer)
-	if len(r) == 0 {
-		soap = SOAP{
-			XMLNs: deviceXMLNs,
-			Body: `<SetNTP xmlns="http://www.onvif.org/ver10/device/wsdl">
-		<FromDHCP>false</FromDHCP>
-		<NTPManual>
-		  <Type xmlns="http://www.onvif.org/ver10/schema">DNS</Type>
-		  <DNSname xmlns="http://www.onvif.org/ver10/schema">` + ntpServer + `</DNSname>
-		</NTPManual>
-	    </SetNTP>`,
-			User:     device.User,
-			Password: device.Password,
-		}
-	} else {
-		soap = SOAP{
-			XMLNs: deviceXMLNs,
-			Body: `<SetNTP xmlns="http://www.onvif.org/ver10/device/wsdl">
-		<FromDHCP>false</FromDHCP>
-		<NTPManual>
-		  <Type xmlns="http://www.onvif.org/ver10/schema">IPv4</Type>
-		  <IPv4Address xmlns="http://www.onvif.org/ver10/schema">` + ntpServer + `</IPv4Address>
-		</NTPManual>
-	    </SetNTP>`,
-			User:     device.User,
-			Password: device.Password,
-		}
+	if len(r) != 0 {
+		ntpManual = networkHostRequest{Type: "IPv4", IPv4Address: ntpServer}
+	}
+
+	soap := SOAP{
+		Request: setNTP{
+			FromDHCP:  false,
+			NTPManual: []networkHostRequest{ntpManual},
+		},
+		User:     device.User,
+		Password: device.Password,
 	}
 
 	// Send SOAP request
-	_, err := soap.SendRequest(device.XAddr)
+	err := device.sendSOAP(ctx, soap, device.XAddr, nil)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// SetDeviceName sets the name scope of an ONVIF camera, and its city
+// location scope when location is not empty. The other configurable scopes
+// are kept. ErrFixedScope is returned when the scope to change is fixed.
 func (device *Device) SetDeviceName(name, location string) error {
-	var soap SOAP
-	// Create SOAP
-	soap = SOAP{
-		XMLNs: deviceXMLNs,
-		Body: `<SetScopes xmlns="http://www.onvif.org/ver10/device/wsdl">
-		<Scopes>onvif://www.onvif.org/name/` + name + `</Scopes>
-		<Scopes>onvif://www.onvif.org/location/city/` + location + `</Scopes>
-	    </SetScopes>`,
-		User:     device.User,
-		Password: device.Password,
-	}
+	return device.SetDeviceNameWithContext(context.Background(), name, location)
+}
 
-	// Send SOAP request
-	_, err := soap.SendRequest(device.XAddr)
+// SetDeviceNameWithContext is the context-aware variant of SetDeviceName.
+func (device *Device) SetDeviceNameWithContext(ctx context.Context, name, location string) error {
+	const (
+		namePrefix     = onvifScopePrefix + "name/"
+		locationPrefix = onvifScopePrefix + "location/city/"
+	)
+
+	current, err := device.GetScopeDefinitionsWithContext(ctx)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	// Keep the configurable scopes which are not replaced
+	scopes := []string{}
+	for _, scope := range current {
+		replaced := hasPrefixFold(scope.Item, namePrefix) ||
+			(location != "" && hasPrefixFold(scope.Item, locationPrefix))
+		switch {
+		case replaced && scope.Definition == ScopeFixed:
+			return fmt.Errorf("%w: %s", ErrFixedScope, scope.Item)
+		case !replaced && scope.Definition != ScopeFixed:
+			scopes = append(scopes, scope.Item)
+		}
+	}
+
+	scopes = append(scopes, namePrefix+url.PathEscape(name))
+	if location != "" {
+		scopes = append(scopes, locationPrefix+url.PathEscape(location))
+	}
+
+	return device.SetScopesWithContext(ctx, scopes)
 }
 
 func (device *Device) SetHostname(name string) error {
-	var soap SOAP
+	return device.SetHostnameWithContext(context.Background(), name)
+}
+
+// SetHostnameWithContext is the context-aware variant of SetHostname.
+func (device *Device) SetHostnameWithContext(ctx context.Context, name string) error {
 	// Create SOAP
-	soap = SOAP{
-		XMLNs: deviceXMLNs,
-		Body: `<SetHostname xmlns="http://www.onvif.org/ver10/device/wsdl">
-		<Name>` + name + `</Name>
-	    </SetHostname>`,
+	soap := SOAP{
+		Request:  setHostname{Name: name},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	_, err := soap.SendRequest(device.XAddr)
+	err := device.sendSOAP(ctx, soap, device.XAddr, nil)
 	if err != nil {
 		return err
 	}
@@ -365,24 +624,26 @@ func (device *Device) SetHostname(name string) error {
 }
 
 func (device *Device) SetNetworkInterfaces() error {
-	var soap SOAP
+	return device.SetNetworkInterfacesWithContext(context.Background())
+}
+
+// SetNetworkInterfacesWithContext is the context-aware variant of SetNetworkInterfaces.
+func (device *Device) SetNetworkInterfacesWithContext(ctx context.Context) error {
 	// Create SOAP
-	soap = SOAP{
-		XMLNs:    []string{`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"`, `xmlns:xsd="http://www.w3.org/2001/XMLSchema"`},
+	soap := SOAP{
+		Request: setNetworkInterfaces{
+			InterfaceToken: "eth0",
+			NetworkInterface: networkInterfaceRequest{
+				Enabled: true,
+				MTU:     1280,
+			},
+		},
 		User:     device.User,
 		Password: device.Password,
 	}
 
-	soap.Body = `<SetNetworkInterfaces xmlns="http://www.onvif.org/ver10/device/wsdl">
-      <InterfaceToken>eth0</InterfaceToken>
-      <NetworkInterface>
-        <Enabled xmlns="http://www.onvif.org/ver10/schema">true</Enabled>
-        <MTU xmlns="http://www.onvif.org/ver10/schema">1280</MTU>
-      </NetworkInterface>
-     </SetNetworkInterfaces>`
-
 	// Send SOAP request
-	_, err := soap.SendRequest(device.XAddr)
+	err := device.sendSOAP(ctx, soap, device.XAddr, nil)
 	if err != nil {
 		return err
 	}
@@ -390,43 +651,35 @@ func (device *Device) SetNetworkInterfaces() error {
 }
 
 func (device *Device) SetSystemDateAndTime(useNTP bool, t time.Time) error {
-	var soap SOAP
+	return device.SetSystemDateAndTimeWithContext(context.Background(), useNTP, t)
+}
+
+// SetSystemDateAndTimeWithContext is the context-aware variant of SetSystemDateAndTime.
+func (device *Device) SetSystemDateAndTimeWithContext(ctx context.Context, useNTP bool, t time.Time) error {
 	// Create SOAP
-	soap = SOAP{
-		XMLNs:    []string{`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"`, `xmlns:xsd="http://www.w3.org/2001/XMLSchema"`},
-		User:     device.User,
-		Password: device.Password,
+	request := setSystemDateAndTime{
+		DateTimeType:    "NTP",
+		DaylightSavings: false,
+	}
+
+	if !useNTP {
+		utc := t.UTC()
+		request.DateTimeType = "Manual"
+		request.TimeZone = &timeZoneRequest{TZ: "CST-8"}
+		request.UTCDateTime = &dateTimeRequest{
+			Time: timeRequest{Hour: utc.Hour(), Minute: utc.Minute(), Second: utc.Second()},
+			Date: dateRequest{Year: utc.Year(), Month: int(utc.Month()), Day: utc.Day()},
+		}
 	}
 
-	if useNTP {
-		soap.Body = `<SetSystemDateAndTime xmlns="http://www.onvif.org/ver10/device/wsdl">
-      <DateTimeType>NTP</DateTimeType>
-      <DaylightSavings>false</DaylightSavings>
-    </SetSystemDateAndTime>`
-	} else {
-		soap.Body = `<SetSystemDateAndTime xmlns="http://www.onvif.org/ver10/device/wsdl">
-      <DateTimeType>Manual</DateTimeType>
-      <DaylightSavings>false</DaylightSavings>
-	  <TimeZone>
-          <TZ>CST-8</TZ>
-	  </TimeZone>
-      <UTCDateTime>
-        <Time xmlns="http://www.onvif.org/ver10/schema">
-          <Hour>` + fmt.Sprintf("%d", t.UTC().Hour()) + `</Hour>
-          <Minute>` + fmt.Sprintf("%d", t.UTC().Minute()) + `</Minute>
-          <Second>` + fmt.Sprintf("%d", t.UTC().Second()) + `</Second>
-        </Time>
-        <Date xmlns="http://www.onvif.org/ver10/schema">
-          <Year>` + fmt.Sprintf("%d", t.UTC().Year()) + `</Year>
-          <Month>` + fmt.Sprintf("%d", t.UTC().Month()) + `</Month>
-          <Day>` + fmt.Sprintf("%d", t.UTC().Day()) + `</Day>
-        </Date>
-      </UTCDateTime>
-    </SetSystemDateAndTime>`
+	soap := SOAP{
+		Request:  request,
+		User:     device.User,
+		Password: device.Password,
 	}
 
 	// Send SOAP request
-	_, err := soap.SendRequest(device.XAddr)
+	err := device.sendSOAP(ctx, soap, device.XAddr, nil)
 	if err != nil {
 		return err
 	}
@@ -434,127 +687,67 @@ func (device *Device) SetSystemDateAndTime(useNTP bool, t time.Time) error {
 }
 
 func (device *Device) GetSystemDateAndTime() (SystemDateAndTime, error) {
+	return device.GetSystemDateAndTimeWithContext(context.Background())
+}
+
+// GetSystemDateAndTimeWithContext is the context-aware variant of GetSystemDateAndTime.
+func (device *Device) GetSystemDateAndTimeWithContext(ctx context.Context) (SystemDateAndTime, error) {
 	// Create SOAP
 	soap := SOAP{
-		Body:     "<tds:GetSystemDateAndTime/>",
-		XMLNs:    deviceXMLNs,
+		Request:  getSystemDateAndTime{},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	var response getSystemDateAndTimeResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
 	if err != nil {
 		return SystemDateAndTime{}, err
 	}
 
-	// Parse response to interface
-	systemDateAndTimeInfo, err := response.ValueForPath("Envelope.Body.GetSystemDateAndTimeResponse")
-	if err != nil {
-		return SystemDateAndTime{}, err
-	}
+	return response.systemDateAndTime()
+}
 
-	// Parse interface to struct
-	result := SystemDateAndTime{}
-	if mapResult, ok := systemDateAndTimeInfo.(map[string]interface{}); ok {
-		if mapInfo, ok := mapResult["SystemDateAndTime"].(map[string]interface{}); ok {
-			result.DateTimeType = interfaceToString(mapInfo["DateTimeType"])
-			result.DaylightSavings = interfaceToBool(mapInfo["DaylightSavings"])
-
-			timeZone := TimeZone_{}
-			if mapParam, ok := mapInfo["TimeZone"].(map[string]interface{}); ok {
-				timeZone.TZ = interfaceToString(mapParam["TZ"])
-			}
-			result.TimeZone = timeZone
-
-			dateTime := DateTime{}
-			if mapParam, ok := mapInfo["UTCDateTime"].(map[string]interface{}); ok {
-				t := Time_{}
-				if mapTime, ok := mapParam["Time"].(map[string]interface{}); ok {
-					t.Hour = interfaceToInt(mapTime["Hour"])
-					t.Minute = interfaceToInt(mapTime["Minute"])
-					t.Second = interfaceToInt(mapTime["Second"])
-				}
-				dateTime.Time = t
-
-				d := Date_{}
-				if mapDate, ok := mapParam["Date"].(map[string]interface{}); ok {
-					d.Year = interfaceToInt(mapDate["Year"])
-					d.Month = interfaceToInt(mapDate["Month"])
-					d.Day = interfaceToInt(mapDate["Day"])
-				}
-				dateTime.Date = d
-			}
-			result.UTCDateTime = dateTime
-
-			dateTime = DateTime{}
-			if mapParam, ok := mapInfo["LocalDateTime"].(map[string]interface{}); ok {
-				t := Time_{}
-				if mapTime, ok := mapParam["Time"].(map[string]interface{}); ok {
-					t.Hour = interfaceToInt(mapTime["Hour"])
-					t.Minute = interfaceToInt(mapTime["Minute"])
-					t.Second = interfaceToInt(mapTime["Second"])
-				}
-				dateTime.Time = t
-				d := Date_{}
-				if mapDate, ok := mapParam["Date"].(map[string]interface{}); ok {
-					d.Year = interfaceToInt(mapDate["Year"])
-					d.Month = interfaceToInt(mapDate["Month"])
-					d.Day = interfaceToInt(mapDate["Day"])
-				}
-				dateTime.Date = d
-			}
-			result.LocalDateTime = dateTime
-		}
+// systemDateAndTime returns the SystemDateAndTime element of the response
+func (response getSystemDateAndTimeResponse) systemDateAndTime() (SystemDateAndTime, error) {
+	if response.SystemDateAndTime == nil {
+		return SystemDateAndTime{}, errMissing("GetSystemDateAndTime", "SystemDateAndTime")
 	}
-
-	return result, nil
+	return *response.SystemDateAndTime, nil
 }
 
 func (device *Device) GetNTP() (NTPInformation, error) {
+	return device.GetNTPWithContext(context.Background())
+}
+
+// GetNTPWithContext is the context-aware variant of GetNTP.
+func (device *Device) GetNTPWithContext(ctx context.Context) (NTPInformation, error) {
 	// Create SOAP
 	soap := SOAP{
-		Body:     "<tds:GetNTP/>",
-		XMLNs:    deviceXMLNs,
+		Request:  getNTP{},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	var response getNTPResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
 	if err != nil {
 		return NTPInformation{}, err
 	}
 
-	// Parse response to interface
-	ntpInformation, err := response.ValueForPath("Envelope.Body.GetNTPResponse")
-	if err != nil {
-		return NTPInformation{}, err
+	info := response.NTPInformation
+	if info == nil {
+		return NTPInformation{}, errMissing("GetNTP", "NTPInformation")
 	}
 
-	// Parse interface to struct
-	result := NTPInformation{}
-	if mapResult, ok := ntpInformation.(map[string]interface{}); ok {
-		if mapInfo, ok := mapResult["NTPInformation"].(map[string]interface{}); ok {
-			result.FromDHCP = interfaceToBool(mapInfo["FromDHCP"])
-
-			ntp := NetworkHost{}
-			if result.FromDHCP {
-				if mapParam, ok := mapInfo["NTPFromDHCP"].(map[string]interface{}); ok {
-					ntp.Type = interfaceToString(mapParam["Type"])
-					ntp.IPv4Address = interfaceToString(mapParam["IPv4Address"])
-					ntp.DNSname = interfaceToString(mapParam["DNSname"])
-				}
-				result.NTPFromDHCP = ntp
-			} else {
-				if mapParam, ok := mapInfo["NTPManual"].(map[string]interface{}); ok {
-					ntp.Type = interfaceToString(mapParam["Type"])
-					ntp.IPv4Address = interfaceToString(mapParam["IPv4Address"])
-					ntp.DNSname = interfaceToString(mapParam["DNSname"])
-				}
-				result.NTPManual = ntp
-			}
-		}
+	result := NTPInformation{FromDHCP: info.FromDHCP}
+	if len(info.NTPFromDHCP) > 0 {
+		result.NTPFromDHCP = info.NTPFromDHCP[0]
+	}
+	if len(info.NTPManual) > 0 {
+		result.NTPManual = info.NTPManual[0]
 	}
 
 	return result, nil
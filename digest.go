@@ -0,0 +1,383 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// httpAuth answers HTTP Basic and Digest (RFC 7616) challenges of a device.
+// The last challenge is cached so following requests are authorized
+// pre-emptively, without an extra round trip.
+type httpAuth struct {
+	mu sync.Mutex
+	// challenge is the last challenge received, nil before the first 401
+	challenge *authChallenge
+	// nc is the nonce count sent with the last request using challenge.nonce
+	nc uint32
+}
+
+type authChallenge struct {
+	scheme    string
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       []string
+	stale     bool
+	userhash  bool
+}
+
+// do sends an HTTP request, answering authentication challenges with user
+// and password. A stale nonce is renewed once. progress, when not nil, is
+// called as body is sent. The returned response body is already read and
+// closed.
+func (auth *httpAuth) do(ctx context.Context, client *http.Client, method, uri string, header http.Header, body []byte, user, password string, progress func(sent, total int64)) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, uri, bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		if progress != nil && len(body) > 0 {
+			req.Body = &progressReader{Reader: bytes.NewReader(body), total: int64(len(body)), progress: progress}
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if err = auth.authorize(req, body, user, password); err != nil {
+			return nil, nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		responseBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized || user == "" || attempt == 2 {
+			return resp, responseBody, nil
+		}
+
+		// A second refusal of a fresh challenge means wrong credentials
+		ok, stale := auth.update(resp)
+		if !ok || (attempt == 1 && !stale) {
+			return resp, responseBody, nil
+		}
+	}
+}
+
+// progressReader reports the bytes read from a request body
+type progressReader struct {
+	io.Reader
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (reader *progressReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	if n > 0 {
+		reader.sent += int64(n)
+		reader.progress(reader.sent, reader.total)
+	}
+	return n, err
+}
+
+func (reader *progressReader) Close() error {
+	return nil
+}
+
+// update caches the challenge of a 401 response. It reports whether the
+// challenge can be answered and whether the server flagged our nonce as stale.
+func (auth *httpAuth) update(resp *http.Response) (ok, stale bool) {
+	challenge := selectChallenge(resp.Header.Values("WWW-Authenticate"))
+	if challenge == nil {
+		return false, false
+	}
+
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	auth.challenge = challenge
+	auth.nc = 0
+
+	return true, challenge.stale
+}
+
+// authorize sets the Authorization header of req when a challenge is cached.
+// body is the request entity, needed for qop=auth-int.
+func (auth *httpAuth) authorize(req *http.Request, body []byte, user, password string) error {
+	if user == "" {
+		return nil
+	}
+
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	challenge := auth.challenge
+	if challenge == nil {
+		return nil
+	}
+
+	if challenge.scheme == "basic" {
+		req.SetBasicAuth(user, password)
+		return nil
+	}
+
+	newHash, sess := digestHash(challenge.algorithm)
+	if newHash == nil {
+		return fmt.Errorf("unsupported digest algorithm %s", challenge.algorithm)
+	}
+	h := func(s string) string {
+		hasher := newHash()
+		hasher.Write([]byte(s))
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	cnonce, err := newCNonce()
+	if err != nil {
+		return err
+	}
+
+	auth.nc++
+	nc := fmt.Sprintf("%08x", auth.nc)
+	uri := req.URL.RequestURI()
+
+	ha1 := h(user + ":" + challenge.realm + ":" + password)
+	if sess {
+		ha1 = h(ha1 + ":" + challenge.nonce + ":" + cnonce)
+	}
+
+	qop := ""
+	for _, offered := range challenge.qop {
+		if offered == "auth" {
+			qop = offered
+			break
+		}
+		if offered == "auth-int" {
+			qop = offered
+		}
+	}
+
+	var response string
+	switch qop {
+	case "auth-int":
+		ha2 := h(req.Method + ":" + uri + ":" + h(string(body)))
+		response = h(ha1 + ":" + challenge.nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	case "auth":
+		ha2 := h(req.Method + ":" + uri)
+		response = h(ha1 + ":" + challenge.nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	default:
+		ha2 := h(req.Method + ":" + uri)
+		response = h(ha1 + ":" + challenge.nonce + ":" + ha2)
+	}
+
+	username := user
+	if challenge.userhash {
+		username = h(user + ":" + challenge.realm)
+	}
+
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, username),
+		fmt.Sprintf(`realm="%s"`, challenge.realm),
+		fmt.Sprintf(`nonce="%s"`, challenge.nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if challenge.algorithm != "" {
+		fields = append(fields, "algorithm="+challenge.algorithm)
+	}
+	if challenge.opaque != "" {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, challenge.opaque))
+	}
+	if qop != "" {
+		fields = append(fields, "qop="+qop, "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	if challenge.userhash {
+		fields = append(fields, "userhash=true")
+	}
+
+	req.Header.Set("Authorization", "Digest "+strings.Join(fields, ", "))
+	return nil
+}
+
+// digestHash returns the hash function of a digest algorithm and whether it
+// is a session variant. A nil function means the algorithm is not supported.
+func digestHash(algorithm string) (func() hash.Hash, bool) {
+	switch strings.ToUpper(algorithm) {
+	case "", "MD5":
+		return md5.New, false
+	case "MD5-SESS":
+		return md5.New, true
+	case "SHA-256":
+		return sha256.New, false
+	case "SHA-256-SESS":
+		return sha256.New, true
+	}
+	return nil, false
+}
+
+func newCNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// selectChallenge picks the strongest supported challenge: Digest SHA-256,
+// then Digest MD5, then Basic
+func selectChallenge(headers []string) *authChallenge {
+	var best *authChallenge
+	rank := func(c *authChallenge) int {
+		if c == nil {
+			return -1
+		}
+		if c.scheme == "basic" {
+			return 0
+		}
+		if strings.HasPrefix(strings.ToUpper(c.algorithm), "SHA-256") {
+			return 2
+		}
+		return 1
+	}
+
+	for _, header := range headers {
+		for _, challenge := range parseChallenges(header) {
+			if challenge.scheme == "digest" {
+				if newHash, _ := digestHash(challenge.algorithm); newHash == nil {
+					continue
+				}
+			}
+			if rank(challenge) > rank(best) {
+				best = challenge
+			}
+		}
+	}
+
+	return best
+}
+
+// parseChallenges parses a WWW-Authenticate header value, which may hold
+// several comma separated challenges
+func parseChallenges(header string) []*authChallenge {
+	var challenges []*authChallenge
+	for _, credentials := range parseAuthHeader(header) {
+		challenge := &authChallenge{scheme: credentials.scheme}
+		for key, value := range credentials.params {
+			challenge.set(key, value)
+		}
+		challenges = append(challenges, challenge)
+	}
+	return challenges
+}
+
+type authParams struct {
+	scheme string
+	params map[string]string
+}
+
+// parseAuthHeader splits a WWW-Authenticate or Authorization header value in
+// schemes and their parameters. Parameter names are lower cased.
+func parseAuthHeader(header string) []authParams {
+	var result []authParams
+
+	s := strings.TrimSpace(header)
+	for s != "" {
+		// Read a token, either a scheme or a parameter name
+		end := strings.IndexAny(s, " \t,=")
+		if end < 0 {
+			end = len(s)
+		}
+		token := s[:end]
+		s = strings.TrimLeft(s[end:], " \t")
+
+		if !strings.HasPrefix(s, "=") {
+			// token is an auth scheme starting a new challenge
+			if token != "" {
+				result = append(result, authParams{
+					scheme: strings.ToLower(token),
+					params: map[string]string{},
+				})
+			}
+			s = strings.TrimLeft(s, " \t,")
+			continue
+		}
+
+		// token is a parameter name, read its value
+		s = strings.TrimLeft(s[1:], " \t")
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			value, s = readQuoted(s[1:])
+		} else {
+			end = strings.IndexAny(s, " \t,")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		s = strings.TrimLeft(s, " \t,")
+
+		if len(result) > 0 {
+			result[len(result)-1].params[strings.ToLower(token)] = value
+		}
+	}
+
+	return result
+}
+
+// readQuoted reads a quoted string whose opening quote was already consumed
+func readQuoted(s string) (value, rest string) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+func (challenge *authChallenge) set(key, value string) {
+	switch key {
+	case "realm":
+		challenge.realm = value
+	case "nonce":
+		challenge.nonce = value
+	case "opaque":
+		challenge.opaque = value
+	case "algorithm":
+		challenge.algorithm = value
+	case "qop":
+		for _, qop := range strings.Split(value, ",") {
+			challenge.qop = append(challenge.qop, strings.TrimSpace(qop))
+		}
+	case "stale":
+		challenge.stale = strings.EqualFold(value, "true")
+	case "userhash":
+		challenge.userhash = strings.EqualFold(value, "true")
+	}
+}
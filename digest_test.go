@@ -0,0 +1,106 @@
+package onvif
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseChallenges(t *testing.T) {
+	challenges := parseChallenges(`Digest realm="cam, main", qop="auth,auth-int", nonce="abc", opaque="xyz", algorithm=SHA-256, stale=true, Basic realm="cam"`)
+	if len(challenges) != 2 {
+		t.Fatalf("expected 2 challenges, got %d", len(challenges))
+	}
+
+	digest := challenges[0]
+	if digest.scheme != "digest" || digest.realm != "cam, main" || digest.nonce != "abc" || digest.opaque != "xyz" {
+		t.Errorf("unexpected digest challenge %+v", digest)
+	}
+	if digest.algorithm != "SHA-256" || !digest.stale || len(digest.qop) != 2 {
+		t.Errorf("unexpected digest parameters %+v", digest)
+	}
+	if challenges[1].scheme != "basic" || challenges[1].realm != "cam" {
+		t.Errorf("unexpected basic challenge %+v", challenges[1])
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDigestSession(t *testing.T) {
+	const user, password, realm = "admin", "secret", "onvif"
+	nonces := []string{"nonce-1", "nonce-2"}
+	nonce := 0
+	challenges := 0
+	var counts []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		challenge := func(stale bool) {
+			challenges++
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", qop="auth", nonce="%s", opaque="op", algorithm=SHA-256, stale=%t`, realm, nonces[nonce], stale))
+			w.WriteHeader(401)
+		}
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			challenge(false)
+			return
+		}
+
+		fields := parseAuthHeader(header)[0].params
+		if fields["nonce"] != nonces[nonce] {
+			challenge(true)
+			return
+		}
+		if fields["opaque"] != "op" {
+			t.Errorf("opaque was not echoed: %s", header)
+		}
+
+		ha1 := sha256Hex(user + ":" + realm + ":" + password)
+		ha2 := sha256Hex(r.Method + ":" + fields["uri"])
+		expected := sha256Hex(ha1 + ":" + fields["nonce"] + ":" + fields["nc"] + ":" + fields["cnonce"] + ":auth:" + ha2)
+		if fields["response"] != expected {
+			challenge(false)
+			return
+		}
+
+		counts = append(counts, fields["nc"])
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	auth := &httpAuth{}
+	get := func() {
+		resp, body, err := auth.do(context.Background(), http.DefaultClient, "GET", server.URL+"/snapshot.jpg", nil, nil, user, password, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 200 || string(body) != "ok" {
+			t.Fatalf("unexpected response %s %s", resp.Status, body)
+		}
+	}
+
+	get()
+	get()
+	if challenges != 1 {
+		t.Errorf("challenge should be reused, got %d challenges", challenges)
+	}
+
+	// Expire the nonce, the session must follow the stale challenge
+	nonce = 1
+	get()
+	if challenges != 2 {
+		t.Errorf("expected a stale re-challenge, got %d challenges", challenges)
+	}
+
+	expected := []string{"00000001", "00000002", "00000001"}
+	if fmt.Sprint(counts) != fmt.Sprint(expected) {
+		t.Errorf("unexpected nonce counts %v", counts)
+	}
+}
@@ -2,95 +2,240 @@ package onvif
 
 import (
 	"context"
-	"fmt"
+	"encoding/xml"
 	"net"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/apex/log"
-	"github.com/clbanning/mxj"
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
-	"golang.org/x/sync/errgroup"
+	"golang.org/x/net/ipv4"
 )
 
 var errWrongDiscoveryResponse = errors.New("Response is not related to discovery request")
 
 // StartDiscovery send a WS-Discovery message and wait for all matching device to respond
 func StartDiscovery(duration time.Duration) ([]*Device, error) {
-	// Get list of interface address
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return []*Device{}, err
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
-	return StartDiscoveryWithContext(ctx, addrs, duration)
+	// Probe from the addresses of every interface
+	return StartDiscoveryWithContext(ctx, nil, duration)
 }
 
+// StartDiscoveryWithContext probes for devices from each address of addrs,
+// or of every interface when addrs is nil, until duration elapses or ctx is
+// done. A device answering on several interfaces is returned once. An error
+// is returned only when the probe failed on every interface.
 func StartDiscoveryWithContext(ctx context.Context, addrs []net.Addr, duration time.Duration) ([]*Device, error) {
-	eg, ctx := errgroup.WithContext(ctx)
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	return StartDiscoveryWithOptions(ctx, addrs, DiscoveryOptions{})
+}
 
+// StartDiscoveryWithOptions probes for the devices selected by options from
+// each address of addrs until ctx is done. The addresses of the interfaces
+// selected by options are used when addrs is nil. Devices not satisfying
+// the options are dropped.
+func StartDiscoveryWithOptions(ctx context.Context, addrs []net.Addr, options DiscoveryOptions) ([]*Device, error) {
 	// Create initial discovery results
 	discoveryResults := []*Device{}
+	err := discover(ctx, addrs, options, options.probeMessage, func(device *Device) {
+		if options.matches(device) {
+			discoveryResults = append(discoveryResults, device)
+		}
+	})
+	if err != nil && len(discoveryResults) == 0 {
+		return nil, err
+	}
+
+	return discoveryResults, nil
+}
+
+// StreamDiscovery probes for devices from each address of addrs, or of
+// every interface when addrs is nil, and sends every device on the returned
+// channel as soon as it answers. A device answering on several interfaces is
+// sent once. Responses are not read while a device waits to be received, so
+// the channel should be drained promptly. The channel is closed when ctx is
+// done.
+func StreamDiscovery(ctx context.Context, addrs []net.Addr) <-chan *Device {
+	return StreamDiscoveryWithOptions(ctx, addrs, DiscoveryOptions{})
+}
+
+// StreamDiscoveryWithOptions is the variant of StreamDiscovery probing for
+// the devices selected by options
+func StreamDiscoveryWithOptions(ctx context.Context, addrs []net.Addr, options DiscoveryOptions) <-chan *Device {
+	devices := make(chan *Device)
+
+	go func() {
+		defer close(devices)
+
+		err := discover(ctx, addrs, options, options.probeMessage, func(device *Device) {
+			if !options.matches(device) {
+				return
+			}
+			select {
+			case devices <- device:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			log.Errorf("Discovery failed: %v", err)
+		}
+	}()
+
+	return devices
+}
+
+// discover multicasts the WS-Discovery message built by request from each
+// IPv4 and IPv6 address of addrs allowed by options, or of the interfaces
+// they select when addrs is nil, and reads the answers until ctx is done.
+// found is called once for each device, never concurrently. The error of a
+// failing interface is returned only when no other interface could probe.
+func discover(ctx context.Context, addrs []net.Addr, options DiscoveryOptions, request func(messageID string) string, found func(*Device)) error {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	seen := make(map[string]bool)
+	failures := 0
+	var lastErr error
+
+	if addrs == nil {
+		var err error
+		if addrs, err = options.interfaceAddrs(); err != nil {
+			return err
+		}
+	}
 
-	// Fetch IPv4 address
+	// Fetch IP address
+	ipAddrs := []*net.IPNet{}
 	for _, addr := range addrs {
 		ipAddr, ok := addr.(*net.IPNet)
-		if ok && !ipAddr.IP.IsLoopback() && ipAddr.IP.To4() != nil {
-			eg.Go(func() error {
-				devices, err := discoverDevices(ipAddr, duration)
-				if err != nil {
-					return err
-				}
+		if ok && !ipAddr.IP.IsLoopback() && options.allows(ipAddr.IP) {
+			ipAddrs = append(ipAddrs, ipAddr)
+		}
+	}
+	if len(ipAddrs) == 0 {
+		return errors.New("No interface address to discover devices from")
+	}
 
-				discoveryResults = append(discoveryResults, devices...)
+	for _, ipAddr := range ipAddrs {
+		wg.Add(1)
+		go func(ipAddr *net.IPNet) {
+			defer wg.Done()
 
-				return nil
+			err := discoverDevices(ctx, ipAddr, options, request, func(device *Device) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				// De-duplicate by endpoint UUID
+				key := device.ID
+				if key == "" {
+					key = device.XAddr
+				}
+				if seen[key] {
+					return
+				}
+				seen[key] = true
+
+				found(device)
 			})
+			if err != nil {
+				log.Warnf("Discovery from %s failed: %v", ipAddr, err)
+
+				mutex.Lock()
+				failures++
+				lastErr = err
+				mutex.Unlock()
+			}
+		}(ipAddr)
+	}
+	wg.Wait()
+
+	if failures == len(ipAddrs) {
+		return errors.Wrap(lastErr, "Discovery failed on every interface")
+	}
+	return nil
+}
+
+// discoverDevices multicasts the WS-Discovery message built by request from
+// ipAddr with the settings of options, and calls found for each device of
+// its subnet answering it, until ctx is done. IPv6 messages are sent to the
+// link-local group FF02::C of the interface holding ipAddr.
+func discoverDevices(ctx context.Context, ipAddr *net.IPNet, options DiscoveryOptions, request func(messageID string) string, found func(*Device)) error {
+	log.Debugf("discoverDevices. IP: %s", ipAddr)
+	// Create WS-Discovery request
+	messageID := newMessageID()
+	message := request(messageID)
+
+	// Create UDP address for local and multicast address
+	localAddress := &net.UDPAddr{IP: ipAddr.IP, Port: options.SourcePort}
+	multicastAddress := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702}
+	zone := ""
+	if ipAddr.IP.To4() == nil {
+		zone = interfaceName(ipAddr.IP)
+		if zone == "" {
+			return errors.Errorf("No interface holds %s", ipAddr.IP)
 		}
+		if ipAddr.IP.IsLinkLocalUnicast() {
+			localAddress.Zone = zone
+		}
+		multicastAddress = &net.UDPAddr{IP: net.ParseIP("ff02::c"), Port: 3702, Zone: zone}
+	}
+
+	// Create UDP connection to listen for respond from matching device
+	conn, err := net.ListenUDP("udp", localAddress)
+	if err != nil {
+		return err
 	}
+	defer conn.Close()
 
-	if err := eg.Wait(); err != nil {
-		return nil, errors.Wrap(err, "Error waiting for discovery to complete")
+	if err = options.configure(conn, zone != ""); err != nil {
+		return err
 	}
 
-	return discoveryResults, nil
+	// Send WS-Discovery request to multicast address, and repeat it as UDP
+	// datagrams may be lost
+	_, err = conn.WriteToUDP([]byte(message), multicastAddress)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go repeatUDP(conn, []byte(message), multicastAddress, options.repeat(), stop)
+
+	return readDiscoveryMatches(ctx, conn, messageID, func(devices []*Device, udpAddr *net.UDPAddr) bool {
+		// Push device to results when reachable from this interface
+		for _, device := range devices {
+			xAddr, ok := subnetXAddr(device.XAddrs, ipAddr, zone)
+			if !ok {
+				continue
+			}
+
+			device.XAddr = xAddr
+			device.IPAddress = udpAddr.IP.String()
+			found(device)
+		}
+		return false
+	})
 }
 
-func discoverDevices(ipAddr *net.IPNet, duration time.Duration) ([]*Device, error) {
-	log.Debugf("discoverDevices. IP: %s. Duration: %s", ipAddr, duration)
-	var now = time.Now()
-	// Create WS-Discovery request
-	messageID := "uuid:" + uuid.Must(uuid.NewV4()).String()
-
-	// var request = `
-	// <?xml version="1.0" encoding="utf-8"?>
-	// <Envelope xmlns:dn="http://www.onvif.org/ver10/network/wsdl"
-	// xmlns="http://www.w3.org/2003/05/soap-envelope">
-	// <Header>
-	// <wsa:MessageID xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing">` + messageID + `</wsa:MessageID>
-	// <wsa:To xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing">urn:schemas-xmlsoap-org:ws:2005:04:discovery</wsa:To>
-	// <wsa:Action xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</wsa:Action>
-	// </Header>
-	// <Body>
-	// <Probe xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
-	// xmlns:xsd="http://www.w3.org/2001/XMLSchema"
-	// xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery">
-	// <Types>dn:NetworkVideoTransmitter</Types>
-	// <Scopes />
-	// </Probe>
-	// </Body>
-	// </Envelope>
-	// `
+// newMessageID returns a unique WS-Addressing message ID
+func newMessageID() string {
+	return "uuid:" + uuid.Must(uuid.NewV4()).String()
+}
+
+// resolveMessage returns a WS-Discovery Resolve for the endpoint address
+func resolveMessage(messageID, address string) string {
 	var request = `
 <s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing">
   <s:Header>
-    <a:Action s:mustUnderstand="1">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action>
+    <a:Action s:mustUnderstand="1">http://schemas.xmlsoap.org/ws/2005/04/discovery/Resolve</a:Action>
     <a:MessageID>` + messageID + `</a:MessageID>
     <a:ReplyTo>
       <a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address>
@@ -98,141 +243,313 @@ func discoverDevices(ipAddr *net.IPNet, duration time.Duration) ([]*Device, erro
     <a:To s:mustUnderstand="1">urn:schemas-xmlsoap-org:ws:2005:04:discovery</a:To>
   </s:Header>
   <s:Body>
-    <Probe xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery">
-      <d:Types xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dp0="http://www.onvif.org/ver10/network/wsdl">dp0:NetworkVideoTransmitter</d:Types>
-    </Probe>
+    <Resolve xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+      <a:EndpointReference>
+        <a:Address>` + escapeXML(address) + `</a:Address>
+      </a:EndpointReference>
+    </Resolve>
   </s:Body>
 </s:Envelope>
 `
-	// Clean WS-Discovery message
+	return cleanDiscoveryMessage(request)
+}
+
+// cleanDiscoveryMessage removes the indentation of a WS-Discovery message
+func cleanDiscoveryMessage(request string) string {
 	request = regexp.MustCompile(`\>\s+\<`).ReplaceAllString(request, "><")
 	request = regexp.MustCompile(`\s+`).ReplaceAllString(request, " ")
-	// Create UDP address for local and multicast address
-	localAddress, err := net.ResolveUDPAddr("udp4", ipAddr.IP.String()+":0")
-	if err != nil {
-		return []*Device{}, err
+	return strings.TrimSpace(request)
+}
+
+// readDiscoveryMatches reads the answers to messageID from conn until ctx is
+// done, or handle returns true. handle receives the devices of each answer
+// and the address of their sender.
+func readDiscoveryMatches(ctx context.Context, conn *net.UDPConn, messageID string, handle func([]*Device, *net.UDPAddr) bool) error {
+	return readUDP(ctx, conn, func(payload []byte, udpAddr *net.UDPAddr, _ net.IP) bool {
+		log.Debugf("Camera replied. Data: %s", string(payload))
+		// Read and parse WS-Discovery response
+		devices, err := readDiscoveryResponse(messageID, payload)
+		if err != nil {
+			if err != errWrongDiscoveryResponse {
+				log.Debugf("Invalid discovery response from %s: %v", udpAddr, err)
+			}
+			return false
+		}
+
+		return handle(devices, udpAddr)
+	})
+}
+
+// readUDP reads the datagrams received on conn until ctx is done, or handle
+// returns true. handle receives each datagram, its sender and its
+// destination, which is nil unless ipv4.FlagDst control messages are enabled
+// on conn. The datagram is only valid until handle returns.
+func readUDP(ctx context.Context, conn *net.UDPConn, handle func([]byte, *net.UDPAddr, net.IP) bool) error {
+	// Unblock the read below when ctx is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	// Keep reading UDP message until ctx is done
+	buffer := make([]byte, 16*1024)
+	oob := ipv4.NewControlMessage(ipv4.FlagDst)
+	for {
+		// Receive UDP message
+		n, oobn, _, udpAddr, err := conn.ReadMsgUDP(buffer, oob)
+
+		// Check if connection timeout
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var dst net.IP
+		var controlMessage ipv4.ControlMessage
+		if oobn > 0 && controlMessage.Parse(oob[:oobn]) == nil {
+			dst = controlMessage.Dst
+		}
+
+		if handle(buffer[:n], udpAddr, dst) {
+			return nil
+		}
 	}
+}
 
-	// fmt.Println("ip", ipAddr, duration, localAddress)
+// discoveryEnvelope is a WS-Discovery message
+type discoveryEnvelope struct {
+	Header struct {
+		MessageID string `xml:"MessageID"`
+		RelatesTo string `xml:"RelatesTo"`
+		Action    string `xml:"Action"`
+	} `xml:"Header"`
+	Body struct {
+		ProbeMatches   []discoveryMatch `xml:"ProbeMatches>ProbeMatch"`
+		ResolveMatches []discoveryMatch `xml:"ResolveMatches>ResolveMatch"`
+		Hello          *discoveryMatch  `xml:"Hello"`
+		Bye            *discoveryMatch  `xml:"Bye"`
+		Probe          *struct {
+			Types  string `xml:"Types"`
+			Scopes struct {
+				MatchBy string `xml:"MatchBy,attr"`
+				Value   string `xml:",chardata"`
+			} `xml:"Scopes"`
+		} `xml:"Probe"`
+		Resolve *struct {
+			Address string `xml:"EndpointReference>Address"`
+		} `xml:"Resolve"`
+	} `xml:"Body"`
+}
 
-	multicastAddress, err := net.ResolveUDPAddr("udp4", "239.255.255.250:3702")
-	if err != nil {
-		return []*Device{}, err
+// discoveryMatch describes a target service in a WS-Discovery message
+type discoveryMatch struct {
+	Address         string `xml:"EndpointReference>Address"`
+	Types           string `xml:"Types"`
+	Scopes          string `xml:"Scopes"`
+	XAddrs          string `xml:"XAddrs"`
+	MetadataVersion string `xml:"MetadataVersion"`
+}
+
+// parseDiscoveryEnvelope parses a WS-Discovery message
+func parseDiscoveryEnvelope(buffer []byte) (*discoveryEnvelope, error) {
+	var envelope discoveryEnvelope
+	if err := xml.Unmarshal(buffer, &envelope); err != nil {
+		return nil, err
 	}
 
-	// Create UDP connection to listen for respond from matching device
-	conn, err := net.ListenUDP("udp", localAddress)
+	envelope.Header.MessageID = strings.TrimSpace(envelope.Header.MessageID)
+	envelope.Header.RelatesTo = strings.TrimSpace(envelope.Header.RelatesTo)
+	envelope.Header.Action = strings.TrimSpace(envelope.Header.Action)
+
+	return &envelope, nil
+}
+
+// readDiscoveryResponse reads and parses WS-Discovery response. A device is
+// returned for each ProbeMatch or ResolveMatch, and for the Hello of a
+// discovery proxy answering in managed mode. Its XAddr is left to
+// PreferredXAddr.
+func readDiscoveryResponse(messageID string, buffer []byte) ([]*Device, error) {
+	envelope, err := parseDiscoveryEnvelope(buffer)
 	if err != nil {
-		return []*Device{}, err
+		return nil, err
 	}
-	defer conn.Close()
 
-	// Set connection's timeout
-	err = conn.SetDeadline(now.Add(duration))
-	if err != nil {
-		return []*Device{}, err
+	// Check if this response is for our request
+	if envelope.Header.RelatesTo != messageID {
+		return nil, errWrongDiscoveryResponse
 	}
 
-	// Send WS-Discovery request to multicast address
-	_, err = conn.WriteToUDP([]byte(request), multicastAddress)
-	if err != nil {
-		return []*Device{}, err
+	matches := append(envelope.Body.ProbeMatches, envelope.Body.ResolveMatches...)
+	devices := make([]*Device, 0, len(matches))
+	for _, match := range matches {
+		device, err := match.device()
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
 	}
 
-	// Create initial discovery results
-	discoveryResults := []*Device{}
+	if hello := envelope.Body.Hello; hello != nil {
+		device, err := hello.device()
+		if err != nil {
+			return nil, err
+		}
+		if device.IsDiscoveryProxy() {
+			devices = append(devices, device)
+		}
+	}
 
-	// Keep reading UDP message until timeout
-	for {
-		// Create buffer and receive UDP response
-		buffer := make([]byte, 16*1024)
-		_, udpAddr, err := conn.ReadFromUDP(buffer)
+	return devices, nil
+}
 
-		// Check if connection timeout
+// device converts the match to a Device
+func (match discoveryMatch) device() (*Device, error) {
+	device := &Device{
+		// Get device's ID and clean it
+		ID:    strings.Replace(strings.TrimSpace(match.Address), "urn:uuid:", "", 1),
+		Types: strings.Fields(match.Types),
+	}
+
+	// Get device's name, MAC address and other scopes
+	device.setScopes(strings.Fields(match.Scopes))
+
+	if version := strings.TrimSpace(match.MetadataVersion); version != "" {
+		metadataVersion, err := strconv.ParseUint(version, 10, 32)
 		if err != nil {
-			if udpErr, ok := err.(net.Error); ok && udpErr.Timeout() {
-				break
-			} else {
-				return discoveryResults, err
-			}
+			return nil, errors.Wrapf(err, "Invalid MetadataVersion of %s", device.ID)
 		}
+		device.MetadataVersion = uint32(metadataVersion)
+	}
 
-		log.Debugf("Camera replied. Data: %s", string(buffer))
-		// Read and parse WS-Discovery response
-		devices, err := readDiscoveryResponse(messageID, buffer)
-		if err != nil && err != errWrongDiscoveryResponse {
-			return discoveryResults, err
+	// Get device's xAddrs, some devices repeat them
+	for _, xAddr := range strings.Fields(match.XAddrs) {
+		if !containsString(device.XAddrs, xAddr) {
+			device.XAddrs = append(device.XAddrs, xAddr)
 		}
+	}
 
-		// fmt.Println(now, device, err)
+	return device, nil
+}
 
-		// Push device to results
-		for _, device := range devices {
-			parsed, _ := url.Parse(device.XAddr)
+// PreferredXAddr picks the address to reach a device among its XAddrs. The
+// choice only depends on the addresses, not on their order. Addresses in
+// subnet come first when it is not nil, then IPv4 addresses, global IPv6
+// addresses, host names and link-local IPv6 addresses. http is preferred to
+// https, and remaining ties are broken alphabetically.
+func PreferredXAddr(xAddrs []string, subnet *net.IPNet) string {
+	best, bestRank := "", -1
+	for _, xAddr := range xAddrs {
+		rank := xAddrRank(xAddr, subnet)
+		if rank > bestRank || (rank == bestRank && xAddr < best) {
+			best, bestRank = xAddr, rank
+		}
+	}
 
-			ipA, _, _ := net.ParseCIDR(fmt.Sprintf("%s/32", parsed.Hostname()))
+	return best
+}
+
+// xAddrRank scores an XAddr for PreferredXAddr, higher is better
+func xAddrRank(xAddr string, subnet *net.IPNet) int {
+	parsed, err := url.Parse(xAddr)
+	if err != nil || parsed.Hostname() == "" {
+		return 0
+	}
+	ip := xAddrIP(parsed)
+
+	rank := 0
+	switch {
+	case ip == nil:
+		rank = 2
+	case ip.To4() != nil:
+		rank = 4
+	case ip.IsLinkLocalUnicast():
+		rank = 1
+	default:
+		rank = 3
+	}
 
-			// log.Debug(ipAddr.IP.String(), ipAddr.Mask.String(), "contains", parsed.Hostname(), " = ", ipAddr.Contains(ipA))
+	if subnet != nil && ip != nil && subnet.Contains(ip) {
+		rank += 10
+	}
 
-			if ipAddr.Contains(ipA) {
-				device.IPAddress = udpAddr.IP.String()
-				discoveryResults = append(discoveryResults, device)
-			}
-		}
+	rank *= 2
+	if parsed.Scheme == "http" {
+		rank++
 	}
 
-	return discoveryResults, nil
+	return rank
 }
 
-// readDiscoveryResponse reads and parses WS-Discovery response
-func readDiscoveryResponse(messageID string, buffer []byte) ([]*Device, error) {
-	// Parse XML to map
-	mapXML, err := mxj.NewMapXml(buffer)
+// subnetXAddr returns the preferred XAddr when it is in subnet. A link-local
+// IPv6 XAddr is scoped to zone, the interface it was received on.
+func subnetXAddr(xAddrs []string, subnet *net.IPNet, zone string) (string, bool) {
+	xAddr := PreferredXAddr(xAddrs, subnet)
+
+	parsed, err := url.Parse(xAddr)
 	if err != nil {
-		return nil, err
+		return "", false
+	}
+	ip := xAddrIP(parsed)
+	if ip == nil || !subnet.Contains(ip) {
+		return "", false
 	}
 
-	// Check if this response is for our request
-	responseMessageID, _ := mapXML.ValueForPathString("Envelope.Header.RelatesTo")
-	if responseMessageID != messageID {
-		return nil, errWrongDiscoveryResponse
+	if ip.To4() == nil && ip.IsLinkLocalUnicast() && zone != "" && !strings.Contains(parsed.Host, "%") {
+		host := net.JoinHostPort(ip.String()+"%"+zone, parsed.Port())
+		if parsed.Port() == "" {
+			host = "[" + ip.String() + "%" + zone + "]"
+		}
+		parsed.Host = host
+		xAddr = parsed.String()
 	}
 
-	// Get device's ID and clean it
-	deviceID, _ := mapXML.ValueForPathString("Envelope.Body.ProbeMatches.ProbeMatch.EndpointReference.Address")
-	deviceID = strings.Replace(deviceID, "urn:uuid:", "", 1)
+	return xAddr, true
+}
 
-	// Get device's name
-	deviceName := ""
-	deviceMAC := ""
-	scopes, _ := mapXML.ValueForPathString("Envelope.Body.ProbeMatches.ProbeMatch.Scopes")
-	for _, scope := range strings.Split(scopes, " ") {
-		if strings.HasPrefix(scope, "onvif://www.onvif.org/name/") {
-			deviceName = strings.Replace(scope, "onvif://www.onvif.org/name/", "", 1)
-			deviceName = strings.Replace(deviceName, "_", " ", -1)
+// interfaceName returns the name of the interface holding ip
+func interfaceName(ip net.IP) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
 		}
-		if strings.HasPrefix(scope, "onvif://www.onvif.org/MAC/") {
-			deviceMAC = strings.Replace(scope, "onvif://www.onvif.org/MAC/", "", 1)
+		for _, addr := range addrs {
+			if ipAddr, ok := addr.(*net.IPNet); ok && ipAddr.IP.Equal(ip) {
+				return iface.Name
+			}
 		}
 	}
 
-	// Get device's xAddrs
-	xAddrs, _ := mapXML.ValueForPathString("Envelope.Body.ProbeMatches.ProbeMatch.XAddrs")
-	listXAddr := strings.Split(xAddrs, " ")
-	if len(listXAddr) == 0 {
-		return nil, errors.New("Device does not have any xAddr")
-	}
+	return ""
+}
 
-	var devices = make([]*Device, len(listXAddr))
+// xAddrIP returns the IP address of an XAddr, nil for a host name. The zone
+// of a link-local IPv6 address is ignored.
+func xAddrIP(xAddr *url.URL) net.IP {
+	host := xAddr.Hostname()
+	if idx := strings.IndexByte(host, '%'); idx >= 0 {
+		host = host[:idx]
+	}
+	return net.ParseIP(host)
+}
 
-	for idx, xAddr := range listXAddr {
-		devices[idx] = &Device{
-			ID:      deviceID,
-			Name:    deviceName,
-			MACAddr: deviceMAC,
-			XAddr:   xAddr,
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
 		}
 	}
-
-	return devices, nil
+	return false
 }
@@ -0,0 +1,205 @@
+package onvif
+
+import (
+	"context"
+	"net"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"golang.org/x/net/ipv4"
+)
+
+// DiscoveryEventType tells whether a device joined or left the network
+type DiscoveryEventType int
+
+const (
+	// DeviceHello is sent by a device joining the network, or when its
+	// metadata changes
+	DeviceHello DiscoveryEventType = iota
+	// DeviceBye is sent by a device leaving the network. Only the ID of
+	// the event's device is set.
+	DeviceBye
+)
+
+func (eventType DiscoveryEventType) String() string {
+	switch eventType {
+	case DeviceHello:
+		return "Hello"
+	case DeviceBye:
+		return "Bye"
+	}
+	return "Unknown"
+}
+
+// DiscoveryEvent is a WS-Discovery announcement of a device
+type DiscoveryEvent struct {
+	Type   DiscoveryEventType
+	Device *Device
+}
+
+// discoveryMessageCache is the number of message IDs remembered to drop the
+// repetitions of a multicast message
+const discoveryMessageCache = 256
+
+// ListenDiscoveryEvents joins the WS-Discovery multicast group on ifaces, or
+// on every multicast interface when ifaces is empty, and sends an event for
+// each Hello and Bye announced by a device. The channel is closed when ctx
+// is done.
+func ListenDiscoveryEvents(ctx context.Context, ifaces []net.Interface) (<-chan DiscoveryEvent, error) {
+	conn, err := listenDiscoveryMulticast(ifaces)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan DiscoveryEvent)
+	go func() {
+		defer close(events)
+		defer conn.Close()
+
+		err := readDiscoveryAnnouncements(ctx, conn, func(event DiscoveryEvent) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			log.Errorf("Listening to discovery announcements failed: %v", err)
+		}
+	}()
+
+	return events, nil
+}
+
+// discoveryMessageIDs remembers the last message IDs received
+type discoveryMessageIDs struct {
+	seen  map[string]bool
+	order []string
+}
+
+// repeated tells whether messageID was already received, and remembers it
+func (ids *discoveryMessageIDs) repeated(messageID string) bool {
+	if messageID == "" {
+		return false
+	}
+	if ids.seen[messageID] {
+		return true
+	}
+
+	if ids.seen == nil {
+		ids.seen = make(map[string]bool)
+	}
+	ids.seen[messageID] = true
+	ids.order = append(ids.order, messageID)
+	if len(ids.order) > discoveryMessageCache {
+		delete(ids.seen, ids.order[0])
+		ids.order = ids.order[1:]
+	}
+	return false
+}
+
+// listenDiscoveryMulticast listens on the WS-Discovery port and joins the
+// multicast group on ifaces
+func listenDiscoveryMulticast(ifaces []net.Interface) (*net.UDPConn, error) {
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702}
+
+	ifaces, err := multicastInterfaces(ifaces)
+	if err != nil {
+		return nil, err
+	}
+
+	// The socket allows other listeners of the port, and joins the group
+	// on the first interface
+	conn, err := net.ListenMulticastUDP("udp4", &ifaces[0], group)
+	if err != nil {
+		return nil, err
+	}
+
+	packetConn := ipv4.NewPacketConn(conn)
+	for _, iface := range ifaces[1:] {
+		iface := iface
+		if err = packetConn.JoinGroup(&iface, group); err != nil {
+			log.Warnf("Could not join WS-Discovery group on %s: %v", iface.Name, err)
+		}
+	}
+
+	return conn, nil
+}
+
+// multicastInterfaces returns ifaces, or every multicast interface which is
+// up when ifaces is empty
+func multicastInterfaces(ifaces []net.Interface) ([]net.Interface, error) {
+	if len(ifaces) > 0 {
+		return ifaces, nil
+	}
+
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range all {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 {
+			ifaces = append(ifaces, iface)
+		}
+	}
+	if len(ifaces) == 0 {
+		return nil, errors.New("No multicast interface to listen on")
+	}
+
+	return ifaces, nil
+}
+
+// readDiscoveryAnnouncements reads Hello and Bye messages from conn until
+// ctx is done
+func readDiscoveryAnnouncements(ctx context.Context, conn *net.UDPConn, announce func(DiscoveryEvent)) error {
+	// Multicast messages are repeated, remember the last IDs seen
+	var seen discoveryMessageIDs
+
+	return readUDP(ctx, conn, func(payload []byte, udpAddr *net.UDPAddr, _ net.IP) bool {
+		envelope, err := parseDiscoveryEnvelope(payload)
+		if err != nil {
+			log.Debugf("Invalid discovery message from %s: %v", udpAddr, err)
+			return false
+		}
+
+		if seen.repeated(envelope.Header.MessageID) {
+			return false
+		}
+
+		event, ok, err := envelope.announcement()
+		if err != nil {
+			log.Debugf("Invalid discovery announcement from %s: %v", udpAddr, err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+
+		event.Device.IPAddress = udpAddr.IP.String()
+		announce(event)
+		return false
+	})
+}
+
+// announcement returns the event of a Hello or Bye message. ok is false for
+// other messages.
+func (envelope *discoveryEnvelope) announcement() (event DiscoveryEvent, ok bool, err error) {
+	switch {
+	case envelope.Body.Hello != nil:
+		event.Type = DeviceHello
+		event.Device, err = envelope.Body.Hello.device()
+		if err != nil {
+			return event, false, err
+		}
+		event.Device.XAddr = PreferredXAddr(event.Device.XAddrs, nil)
+	case envelope.Body.Bye != nil:
+		event.Type = DeviceBye
+		event.Device, err = envelope.Body.Bye.device()
+		if err != nil {
+			return event, false, err
+		}
+	default:
+		return event, false, nil
+	}
+
+	return event, true, nil
+}
@@ -0,0 +1,105 @@
+package onvif
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+const helloMessage = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"
+xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<s:Header>
+	<a:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Hello</a:Action>
+	<a:MessageID>urn:uuid:hello-1</a:MessageID>
+	<d:AppSequence InstanceId="7" MessageNumber="1"/>
+</s:Header>
+<s:Body><d:Hello>
+	<a:EndpointReference><a:Address>urn:uuid:cam-1</a:Address></a:EndpointReference>
+	<d:Types>dn:NetworkVideoTransmitter</d:Types>
+	<d:Scopes>onvif://www.onvif.org/name/Lobby</d:Scopes>
+	<d:XAddrs>http://192.0.2.10/onvif/device_service</d:XAddrs>
+	<d:MetadataVersion>1</d:MetadataVersion>
+</d:Hello></s:Body></s:Envelope>`
+
+const byeMessage = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"
+xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<s:Header>
+	<a:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Bye</a:Action>
+	<a:MessageID>urn:uuid:bye-1</a:MessageID>
+</s:Header>
+<s:Body><d:Bye>
+	<a:EndpointReference><a:Address>urn:uuid:cam-1</a:Address></a:EndpointReference>
+</d:Bye></s:Body></s:Envelope>`
+
+func TestDiscoveryAnnouncement(t *testing.T) {
+	envelope, err := parseDiscoveryEnvelope([]byte(helloMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, ok, err := envelope.announcement()
+	if err != nil || !ok {
+		t.Fatalf("Hello was not parsed: %v", err)
+	}
+	if event.Type != DeviceHello || event.Device.ID != "cam-1" || event.Device.Name != "Lobby" ||
+		event.Device.XAddr != "http://192.0.2.10/onvif/device_service" {
+		t.Errorf("unexpected event %s %+v", event.Type, event.Device)
+	}
+
+	envelope, err = parseDiscoveryEnvelope([]byte(byeMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, ok, err = envelope.announcement()
+	if err != nil || !ok {
+		t.Fatalf("Bye was not parsed: %v", err)
+	}
+	if event.Type != DeviceBye || event.Device.ID != "cam-1" {
+		t.Errorf("unexpected event %s %+v", event.Type, event.Device)
+	}
+}
+
+func TestListenDiscoveryEvents(t *testing.T) {
+	ipAddr := localIPv4(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, err := ListenDiscoveryEvents(ctx, nil)
+	if err != nil {
+		t.Skipf("cannot join the WS-Discovery group: %v", err)
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: ipAddr.IP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The repetition of the Hello is dropped
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702}
+	for _, message := range []string{helloMessage, helloMessage, byeMessage} {
+		if _, err = conn.WriteToUDP([]byte(message), group); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var received []DiscoveryEventType
+	for len(received) < 2 {
+		select {
+		case event := <-events:
+			received = append(received, event.Type)
+		case <-ctx.Done():
+			t.Fatalf("expected Hello and Bye, received %v", received)
+		}
+	}
+	if received[0] != DeviceHello || received[1] != DeviceBye {
+		t.Errorf("expected Hello and Bye, received %v", received)
+	}
+
+	cancel()
+	for range events {
+	}
+}
@@ -0,0 +1,397 @@
+package onvif
+
+import (
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// DeviceType is the qualified name of a type probed by WS-Discovery
+type DeviceType struct {
+	Namespace string
+	Name      string
+}
+
+// Device types defined by ONVIF
+var (
+	// TypeNetworkVideoTransmitter is implemented by cameras and encoders
+	TypeNetworkVideoTransmitter = DeviceType{Namespace: "http://www.onvif.org/ver10/network/wsdl", Name: "NetworkVideoTransmitter"}
+	// TypeNetworkVideoDisplay is implemented by displays and decoders
+	TypeNetworkVideoDisplay = DeviceType{Namespace: "http://www.onvif.org/ver10/network/wsdl", Name: "NetworkVideoDisplay"}
+	// TypeNetworkDevice is implemented by any ONVIF device
+	TypeNetworkDevice = DeviceType{Namespace: "http://www.onvif.org/ver10/network/wsdl", Name: "Device"}
+	// TypeDeviceService is the device service type, tds:Device
+	TypeDeviceService = DeviceType{Namespace: "http://www.onvif.org/ver10/device/wsdl", Name: "Device"}
+)
+
+// Matching rules of the probe scopes
+const (
+	// MatchByRFC3986 matches a scope prefixing the device scope segment by
+	// segment. It is the default rule.
+	MatchByRFC3986 = "http://schemas.xmlsoap.org/ws/2005/04/discovery/rfc3986"
+	// MatchByUUID matches a scope with the same UUID
+	MatchByUUID = "http://schemas.xmlsoap.org/ws/2005/04/discovery/uuid"
+	// MatchByLDAP matches a scope prefixing the device LDAP scope
+	MatchByLDAP = "http://schemas.xmlsoap.org/ws/2005/04/discovery/ldap"
+	// MatchByStrcmp0 matches an identical scope
+	MatchByStrcmp0 = "http://schemas.xmlsoap.org/ws/2005/04/discovery/strcmp0"
+)
+
+// onvifScopePrefix is the prefix of the scopes defined by ONVIF
+const onvifScopePrefix = "onvif://www.onvif.org/"
+
+// SOAP-over-UDP retransmission parameters
+const (
+	// MulticastUDPRepeat is the default number of retransmissions of a
+	// multicast probe
+	MulticastUDPRepeat = 2
+	// UnicastUDPRepeat is the default number of retransmissions of a
+	// unicast probe
+	UnicastUDPRepeat = 2
+
+	udpMinDelay   = 50 * time.Millisecond
+	udpMaxDelay   = 250 * time.Millisecond
+	udpUpperDelay = 500 * time.Millisecond
+)
+
+// DiscoveryOptions selects the devices answering a discovery probe, and the
+// interfaces and multicast settings used to probe
+type DiscoveryOptions struct {
+	// Types must all be implemented by a device,
+	// TypeNetworkVideoTransmitter when empty
+	Types []DeviceType
+	// Scopes must all match a scope of the device. A scope without scheme,
+	// like Profile/Streaming, is relative to onvif://www.onvif.org/.
+	Scopes []string
+	// MatchBy is the rule matching Scopes, MatchByRFC3986 when empty
+	MatchBy string
+
+	// InterfaceNames and InterfaceIndexes select the interfaces probed when
+	// no address is given, every interface which is up when both are empty
+	InterfaceNames   []string
+	InterfaceIndexes []int
+	// AllowNetworks keeps only the addresses inside one of them when not
+	// empty, and DenyNetworks drops the addresses inside one of them
+	AllowNetworks []*net.IPNet
+	DenyNetworks  []*net.IPNet
+
+	// TTL is the multicast TTL, or hop limit, of the probes. The system
+	// default, usually 1, is used when zero.
+	TTL int
+	// DisableLoopback stops the probes from reaching the devices of this
+	// host
+	DisableLoopback bool
+	// SourcePort is the local UDP port of the probes, a random port when
+	// zero
+	SourcePort int
+	// Repeat is the number of retransmissions of probes, MulticastUDPRepeat
+	// or UnicastUDPRepeat when zero. A negative value disables them.
+	Repeat int
+}
+
+// interfaceAddrs returns the addresses of the interfaces selected
+func (options DiscoveryOptions) interfaceAddrs() ([]net.Addr, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []net.Addr
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || !options.selects(iface) {
+			continue
+		}
+
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, ifaceAddrs...)
+	}
+
+	return addrs, nil
+}
+
+// selects tells whether the interface is selected by name or index
+func (options DiscoveryOptions) selects(iface net.Interface) bool {
+	if len(options.InterfaceNames) == 0 && len(options.InterfaceIndexes) == 0 {
+		return true
+	}
+
+	if containsString(options.InterfaceNames, iface.Name) {
+		return true
+	}
+	for _, index := range options.InterfaceIndexes {
+		if index == iface.Index {
+			return true
+		}
+	}
+	return false
+}
+
+// allows tells whether an address passes the allow and deny lists
+func (options DiscoveryOptions) allows(ip net.IP) bool {
+	for _, network := range options.DenyNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(options.AllowNetworks) == 0 {
+		return true
+	}
+	for _, network := range options.AllowNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// configure applies the multicast settings to a probing connection
+func (options DiscoveryOptions) configure(conn *net.UDPConn, v6 bool) error {
+	if v6 {
+		packetConn := ipv6.NewPacketConn(conn)
+		if options.TTL > 0 {
+			if err := packetConn.SetMulticastHopLimit(options.TTL); err != nil {
+				return err
+			}
+		}
+		return packetConn.SetMulticastLoopback(!options.DisableLoopback)
+	}
+
+	packetConn := ipv4.NewPacketConn(conn)
+	if options.TTL > 0 {
+		if err := packetConn.SetMulticastTTL(options.TTL); err != nil {
+			return err
+		}
+	}
+	return packetConn.SetMulticastLoopback(!options.DisableLoopback)
+}
+
+// repeat returns the number of retransmissions of multicast probes
+func (options DiscoveryOptions) repeat() int {
+	switch {
+	case options.Repeat < 0:
+		return 0
+	case options.Repeat == 0:
+		return MulticastUDPRepeat
+	}
+	return options.Repeat
+}
+
+// unicastRepeat returns the number of retransmissions of unicast probes
+func (options DiscoveryOptions) unicastRepeat() int {
+	switch {
+	case options.Repeat < 0:
+		return 0
+	case options.Repeat == 0:
+		return UnicastUDPRepeat
+	}
+	return options.Repeat
+}
+
+// repeatUDP sends message again repeat times to address, until stop is
+// closed. The first delay is random between UDP_MIN_DELAY and
+// UDP_MAX_DELAY, and doubles up to UDP_UPPER_DELAY.
+func repeatUDP(conn *net.UDPConn, message []byte, address *net.UDPAddr, repeat int, stop <-chan struct{}) {
+	delay := udpMinDelay + time.Duration(rand.Int63n(int64(udpMaxDelay-udpMinDelay)+1))
+	for i := 0; i < repeat; i++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if _, err := conn.WriteToUDP(message, address); err != nil {
+			log.Debugf("Retransmission to %s failed: %v", address, err)
+			return
+		}
+
+		delay *= 2
+		if delay > udpUpperDelay {
+			delay = udpUpperDelay
+		}
+	}
+}
+
+// types returns the probed types
+func (options DiscoveryOptions) types() []DeviceType {
+	if len(options.Types) == 0 {
+		return []DeviceType{TypeNetworkVideoTransmitter}
+	}
+	return options.Types
+}
+
+// scopes returns the probed scopes as absolute URIs
+func (options DiscoveryOptions) scopes() []string {
+	return absoluteScopes(options.Scopes)
+}
+
+// absoluteScopes makes the scopes without scheme relative to
+// onvif://www.onvif.org/
+func absoluteScopes(relative []string) []string {
+	scopes := make([]string, 0, len(relative))
+	for _, scope := range relative {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if !strings.Contains(scope, ":") {
+			scope = onvifScopePrefix + strings.TrimPrefix(scope, "/")
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes
+}
+
+// probeMessage returns a WS-Discovery Probe for the types and scopes of the
+// options
+func (options DiscoveryOptions) probeMessage(messageID string) string {
+	var scopes string
+	if probeScopes := options.scopes(); len(probeScopes) > 0 {
+		var matchBy string
+		if options.MatchBy != "" {
+			matchBy = ` MatchBy="` + escapeXML(options.MatchBy) + `"`
+		}
+		scopes = `<d:Scopes xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery"` + matchBy + `>` +
+			escapeXML(strings.Join(probeScopes, " ")) + `</d:Scopes>`
+	}
+
+	var request = `
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing">
+  <s:Header>
+    <a:Action s:mustUnderstand="1">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action>
+    <a:MessageID>` + messageID + `</a:MessageID>
+    <a:ReplyTo>
+      <a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address>
+    </a:ReplyTo>
+    <a:To s:mustUnderstand="1">urn:schemas-xmlsoap-org:ws:2005:04:discovery</a:To>
+  </s:Header>
+  <s:Body>
+    <Probe xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+      ` + typesElement(options.types()) + `
+      ` + scopes + `
+    </Probe>
+  </s:Body>
+</s:Envelope>
+`
+	return cleanDiscoveryMessage(request)
+}
+
+// typesElement returns the d:Types element listing types. Each type
+// namespace is declared with its own prefix.
+func typesElement(types []DeviceType) string {
+	var namespaces, names []string
+	for i, deviceType := range types {
+		prefix := "dp" + strconv.Itoa(i)
+		namespaces = append(namespaces, ` xmlns:`+prefix+`="`+escapeXML(deviceType.Namespace)+`"`)
+		names = append(names, prefix+":"+escapeXML(deviceType.Name))
+	}
+
+	return `<d:Types xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery"` + strings.Join(namespaces, "") + `>` +
+		strings.Join(names, " ") + `</d:Types>`
+}
+
+// matches tells whether a device answering the probe satisfies the types and
+// scopes set in the options, as some devices answer every probe. Types are
+// compared on their local name, as the prefixes of the answer are not
+// resolved. Scopes matched by the UUID and LDAP rules are not checked.
+// Discovery proxies only match a probe for TypeDiscoveryProxy.
+func (options DiscoveryOptions) matches(device *Device) bool {
+	if device.IsDiscoveryProxy() && !containsDeviceType(options.Types, TypeDiscoveryProxy) {
+		return false
+	}
+
+	for _, deviceType := range options.Types {
+		found := false
+		for _, name := range device.Types {
+			if name[strings.LastIndex(name, ":")+1:] == deviceType.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, scope := range options.scopes() {
+		found := false
+		for _, deviceScope := range device.Scopes {
+			if matchScope(options.MatchBy, scope, deviceScope) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsDeviceType tells whether types contains deviceType
+func containsDeviceType(types []DeviceType, deviceType DeviceType) bool {
+	for _, t := range types {
+		if t == deviceType {
+			return true
+		}
+	}
+	return false
+}
+
+// matchScope tells whether the probe scope matches the device scope with the
+// matching rule
+func matchScope(matchBy, scope, deviceScope string) bool {
+	switch matchBy {
+	case "", MatchByRFC3986:
+		return matchScopeRFC3986(scope, deviceScope)
+	case MatchByStrcmp0:
+		return scope == deviceScope
+	}
+	return true
+}
+
+// matchScopeRFC3986 matches the scheme and authority ignoring case, and the
+// path segments of scope as a prefix of those of deviceScope
+func matchScopeRFC3986(scope, deviceScope string) bool {
+	scopeURL, err := url.Parse(scope)
+	if err != nil {
+		return false
+	}
+	deviceURL, err := url.Parse(deviceScope)
+	if err != nil {
+		return false
+	}
+
+	if !strings.EqualFold(scopeURL.Scheme, deviceURL.Scheme) || !strings.EqualFold(scopeURL.Host, deviceURL.Host) {
+		return false
+	}
+
+	segments := strings.Split(strings.Trim(scopeURL.EscapedPath(), "/"), "/")
+	deviceSegments := strings.Split(strings.Trim(deviceURL.EscapedPath(), "/"), "/")
+	if len(segments) == 1 && segments[0] == "" {
+		return true
+	}
+	if len(segments) > len(deviceSegments) {
+		return false
+	}
+	for i, segment := range segments {
+		if segment != deviceSegments[i] {
+			return false
+		}
+	}
+
+	return true
+}
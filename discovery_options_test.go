@@ -0,0 +1,158 @@
+package onvif
+
+import (
+	"encoding/xml"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryProbeMessage(t *testing.T) {
+	options := DiscoveryOptions{
+		Types:   []DeviceType{TypeNetworkVideoDisplay, TypeDeviceService, {Namespace: "urn:vendor&co", Name: "Recorder"}},
+		Scopes:  []string{"onvif://www.onvif.org/location/building-7", "Profile/Streaming"},
+		MatchBy: MatchByStrcmp0,
+	}
+
+	var probe struct {
+		Body struct {
+			Probe struct {
+				Types  string `xml:"Types"`
+				Scopes struct {
+					MatchBy string `xml:"MatchBy,attr"`
+					Value   string `xml:",chardata"`
+				} `xml:"Scopes"`
+			} `xml:"http://schemas.xmlsoap.org/ws/2005/04/discovery Probe"`
+		} `xml:"Body"`
+	}
+	message := options.probeMessage("uuid:1")
+	if err := xml.Unmarshal([]byte(message), &probe); err != nil {
+		t.Fatal(err)
+	}
+
+	if probe.Body.Probe.Types != "dp0:NetworkVideoDisplay dp1:Device dp2:Recorder" {
+		t.Errorf("unexpected types %q", probe.Body.Probe.Types)
+	}
+	for _, namespace := range []string{
+		`xmlns:dp0="http://www.onvif.org/ver10/network/wsdl"`,
+		`xmlns:dp1="http://www.onvif.org/ver10/device/wsdl"`,
+		`xmlns:dp2="urn:vendor&amp;co"`,
+	} {
+		if !strings.Contains(message, namespace) {
+			t.Errorf("probe does not declare %s", namespace)
+		}
+	}
+	if scopes := probe.Body.Probe.Scopes; scopes.MatchBy != MatchByStrcmp0 ||
+		scopes.Value != "onvif://www.onvif.org/location/building-7 onvif://www.onvif.org/Profile/Streaming" {
+		t.Errorf("unexpected scopes %+v", scopes)
+	}
+
+	// The default probe looks for network video transmitters in any scope
+	message = DiscoveryOptions{}.probeMessage("uuid:2")
+	if !strings.Contains(message, ">dp0:NetworkVideoTransmitter</d:Types>") || strings.Contains(message, "Scopes") {
+		t.Errorf("unexpected default probe %s", message)
+	}
+}
+
+func TestDiscoveryOptionsMatches(t *testing.T) {
+	device := &Device{
+		Types: []string{"dn:NetworkVideoTransmitter", "tds:Device"},
+		Scopes: []string{
+			"onvif://www.onvif.org/Profile/Streaming",
+			"onvif://www.onvif.org/location/building-7/floor-2",
+			"ONVIF://www.onvif.org/type/video_encoder",
+		},
+	}
+
+	tests := []struct {
+		options  DiscoveryOptions
+		expected bool
+	}{
+		{DiscoveryOptions{}, true},
+		{DiscoveryOptions{Types: []DeviceType{TypeNetworkVideoTransmitter, TypeDeviceService}}, true},
+		{DiscoveryOptions{Types: []DeviceType{TypeNetworkVideoDisplay}}, false},
+		{DiscoveryOptions{Scopes: []string{"location/building-7"}}, true},
+		{DiscoveryOptions{Scopes: []string{"onvif://www.onvif.org/location/building-7/floor-2"}}, true},
+		{DiscoveryOptions{Scopes: []string{"onvif://WWW.ONVIF.ORG/type"}}, true},
+		{DiscoveryOptions{Scopes: []string{"location/building"}}, false},
+		{DiscoveryOptions{Scopes: []string{"location/building-7", "Profile/G"}}, false},
+		{DiscoveryOptions{Scopes: []string{"location/building-7"}, MatchBy: MatchByStrcmp0}, false},
+		{DiscoveryOptions{Scopes: []string{"Profile/Streaming"}, MatchBy: MatchByStrcmp0}, true},
+		{DiscoveryOptions{Scopes: []string{"ldap:///ou=cameras"}, MatchBy: MatchByLDAP}, true},
+	}
+	for _, test := range tests {
+		if matches := test.options.matches(device); matches != test.expected {
+			t.Errorf("%+v: expected %v, got %v", test.options, test.expected, matches)
+		}
+	}
+}
+
+func TestDiscoveryOptionsInterfaces(t *testing.T) {
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	_, docker, _ := net.ParseCIDR("172.17.0.0/16")
+	options := DiscoveryOptions{
+		AllowNetworks: []*net.IPNet{private, docker},
+		DenyNetworks:  []*net.IPNet{docker},
+	}
+	for ip, expected := range map[string]bool{
+		"10.1.2.3":    true,
+		"172.17.0.1":  false,
+		"192.168.1.2": false,
+	} {
+		if allowed := options.allows(net.ParseIP(ip)); allowed != expected {
+			t.Errorf("%s: expected %v, got %v", ip, expected, allowed)
+		}
+	}
+
+	loopback := net.Interface{Index: 1, Name: "lo"}
+	other := net.Interface{Index: 2, Name: "eth0"}
+	if !(DiscoveryOptions{}).selects(other) {
+		t.Error("no selection should select every interface")
+	}
+	if options := (DiscoveryOptions{InterfaceNames: []string{"lo"}}); !options.selects(loopback) || options.selects(other) {
+		t.Error("unexpected selection by name")
+	}
+	if options := (DiscoveryOptions{InterfaceIndexes: []int{2}}); options.selects(loopback) || !options.selects(other) {
+		t.Error("unexpected selection by index")
+	}
+}
+
+func TestDiscoveryRepeat(t *testing.T) {
+	receiver, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	sender, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		repeatUDP(sender, []byte("probe"), receiver.LocalAddr().(*net.UDPAddr), MulticastUDPRepeat, stop)
+		close(done)
+	}()
+
+	// The retransmissions are sent within UDP_MAX_DELAY + UDP_UPPER_DELAY
+	receiver.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buffer := make([]byte, 16)
+	for i := 0; i < MulticastUDPRepeat; i++ {
+		if _, _, err := receiver.ReadFromUDP(buffer); err != nil {
+			t.Fatalf("retransmission %d not received: %v", i+1, err)
+		}
+	}
+	<-done
+
+	// Closing stop cancels the pending retransmissions
+	start := time.Now()
+	go repeatUDP(sender, []byte("probe"), receiver.LocalAddr().(*net.UDPAddr), MulticastUDPRepeat, stop)
+	close(stop)
+	receiver.SetReadDeadline(time.Now().Add(udpMaxDelay + 100*time.Millisecond))
+	if _, _, err := receiver.ReadFromUDP(buffer); err == nil {
+		t.Errorf("retransmission received %v after stop", time.Since(start))
+	}
+}
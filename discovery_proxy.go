@@ -0,0 +1,156 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TypeDiscoveryProxy is the type of WS-Discovery proxies
+var TypeDiscoveryProxy = DeviceType{Namespace: "http://schemas.xmlsoap.org/ws/2005/04/discovery", Name: "DiscoveryProxy"}
+
+// IsDiscoveryProxy tells whether the device announced itself as a
+// WS-Discovery proxy
+func (device *Device) IsDiscoveryProxy() bool {
+	for _, name := range device.Types {
+		if localName(name) == TypeDiscoveryProxy.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// DiscoveryProxy sends probes and resolves to a WS-Discovery proxy, which
+// answers for the devices of sites where multicast does not reach. A proxy
+// is found in the Hello events of ListenDiscoveryEvents, or by probing for
+// TypeDiscoveryProxy, and is then reached on the XAddr of its device.
+type DiscoveryProxy struct {
+	// Address is the http or https URL of the proxy, or its soap.udp URL
+	// or host:port address to use UDP
+	Address string
+	// Client configures the HTTP client used with the proxy
+	Client ClientOptions
+}
+
+// Probe sends a probe for the devices selected by options to the proxy. It
+// waits for the answer until ctx is done, or for DefaultTimeout when ctx has
+// no deadline.
+func (proxy DiscoveryProxy) Probe(ctx context.Context, options DiscoveryOptions) ([]*Device, error) {
+	devices, err := proxy.send(ctx, options.unicastRepeat(), options.probeMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []*Device{}
+	for _, device := range devices {
+		if options.matches(device) {
+			matching = append(matching, device)
+		}
+	}
+	return matching, nil
+}
+
+// Resolve asks the proxy for the current XAddrs of endpoint, a device ID or
+// endpoint address
+func (proxy DiscoveryProxy) Resolve(ctx context.Context, endpoint string) (*Device, error) {
+	address := endpointAddress(endpoint)
+	devices, err := proxy.send(ctx, UnicastUDPRepeat, func(messageID string) string {
+		return resolveMessage(messageID, address)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		if endpointAddress(device.ID) == address {
+			return device, nil
+		}
+	}
+	return nil, errors.Errorf("Proxy did not resolve %s", endpoint)
+}
+
+// send sends the WS-Discovery message built by request to the proxy and
+// returns the devices of its answer. A message sent by UDP is retransmitted
+// repeat times.
+func (proxy DiscoveryProxy) send(ctx context.Context, repeat int, request func(messageID string) string) ([]*Device, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	address := strings.TrimSpace(proxy.Address)
+	if strings.HasPrefix(address, "soap.udp://") {
+		udpURL, err := url.Parse(address)
+		if err != nil {
+			return nil, err
+		}
+		address = udpURL.Host
+		if udpURL.Port() == "" {
+			address = net.JoinHostPort(udpURL.Hostname(), discoveryPort)
+		}
+	}
+
+	var devices []*Device
+	var err error
+	if strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://") {
+		devices, err = proxy.sendHTTP(ctx, address, request)
+	} else {
+		devices, err = unicastDiscovery(ctx, address, repeat, request)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The devices are not on the network of the proxy
+	for _, device := range devices {
+		device.XAddr = PreferredXAddr(device.XAddrs, nil)
+		device.IPAddress = ""
+		if xAddr, err := url.Parse(device.XAddr); err == nil {
+			device.IPAddress = xAddr.Hostname()
+		}
+	}
+
+	return devices, nil
+}
+
+// sendHTTP posts the WS-Discovery message to the proxy, SOAP over HTTP
+func (proxy DiscoveryProxy) sendHTTP(ctx context.Context, address string, request func(messageID string) string) ([]*Device, error) {
+	messageID := newMessageID()
+	message := request(messageID)
+
+	httpRequest, err := http.NewRequestWithContext(ctx, "POST", address, bytes.NewReader([]byte(message)))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+
+	Debugf("[>>>%s]%s", address, message)
+	resp, err := proxy.Client.httpClient().Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	Debugf("[<<<%s]%s", address, string(body))
+
+	if fault := parseFault(body); fault != nil {
+		fault.StatusCode = resp.StatusCode
+		return nil, fault
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+
+	return readDiscoveryResponse(messageID, body)
+}
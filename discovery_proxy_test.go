@@ -0,0 +1,96 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiscoveryProxyHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		envelope, err := parseDiscoveryEnvelope(body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"
+xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<s:Header><a:RelatesTo>%s</a:RelatesTo></s:Header>
+<s:Body><d:ProbeMatches>
+<d:ProbeMatch>
+	<a:EndpointReference><a:Address>urn:uuid:site-camera</a:Address></a:EndpointReference>
+	<d:Types>dn:NetworkVideoTransmitter</d:Types>
+	<d:Scopes>onvif://www.onvif.org/location/building-7</d:Scopes>
+	<d:XAddrs>http://[2001:db8::30]/onvif/device_service http://10.20.0.30/onvif/device_service</d:XAddrs>
+</d:ProbeMatch>
+<d:ProbeMatch>
+	<a:EndpointReference><a:Address>urn:uuid:site-display</a:Address></a:EndpointReference>
+	<d:Types>dn:NetworkVideoDisplay</d:Types>
+	<d:XAddrs>http://10.20.0.31/onvif/device_service</d:XAddrs>
+</d:ProbeMatch>
+</d:ProbeMatches></s:Body></s:Envelope>`, envelope.Header.MessageID)
+	}))
+	defer server.Close()
+
+	proxy := DiscoveryProxy{Address: server.URL}
+	devices, err := proxy.Probe(context.Background(), DiscoveryOptions{
+		Types: []DeviceType{TypeNetworkVideoTransmitter},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("expected 1 device, got %d", len(devices))
+	}
+	if device := devices[0]; device.ID != "site-camera" || device.XAddr != "http://10.20.0.30/onvif/device_service" || device.IPAddress != "10.20.0.30" {
+		t.Errorf("unexpected device %+v", device)
+	}
+}
+
+func TestDiscoveryProxyUDP(t *testing.T) {
+	responder := fakeDiscoveryResponder(t)
+	defer responder.Close()
+
+	proxy := DiscoveryProxy{Address: "soap.udp://" + responder.LocalAddr().String()}
+	device, err := proxy.Resolve(context.Background(), "routed-camera")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.XAddr != "http://127.0.0.1/onvif/device_service" || device.IPAddress != "127.0.0.1" {
+		t.Errorf("unexpected device %+v", device)
+	}
+
+	if _, err = proxy.Resolve(context.Background(), "other-camera"); err == nil {
+		t.Error("expected an error for another endpoint")
+	}
+}
+
+func TestDiscoveryProxyHello(t *testing.T) {
+	const hello = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"
+xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<s:Header><a:RelatesTo>uuid:probe</a:RelatesTo></s:Header>
+<s:Body><d:Hello>
+	<a:EndpointReference><a:Address>urn:uuid:site-proxy</a:Address></a:EndpointReference>
+	<d:Types>d:DiscoveryProxy</d:Types>
+	<d:XAddrs>http://10.20.0.2:5357/discovery</d:XAddrs>
+</d:Hello></s:Body></s:Envelope>`
+
+	devices, err := readDiscoveryResponse("uuid:probe", []byte(hello))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || !devices[0].IsDiscoveryProxy() {
+		t.Fatalf("expected the proxy, got %+v", devices)
+	}
+	if (DiscoveryOptions{}).matches(devices[0]) {
+		t.Error("a proxy matched a probe for devices")
+	}
+	if !(DiscoveryOptions{Types: []DeviceType{TypeDiscoveryProxy}}).matches(devices[0]) {
+		t.Error("a proxy did not match a probe for proxies")
+	}
+}
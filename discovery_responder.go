@@ -0,0 +1,240 @@
+package onvif
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"golang.org/x/net/ipv4"
+)
+
+// appMaxDelay is the APP_MAX_DELAY of WS-Discovery, the longest random
+// delay before answering a multicast message
+const appMaxDelay = 500 * time.Millisecond
+
+// DiscoveryResponder makes a local device discoverable: it answers the
+// WS-Discovery probes and resolves matching it, and announces the device
+// with Hello and Bye messages.
+type DiscoveryResponder struct {
+	// ID is the UUID or endpoint address of the device
+	ID string
+	// Types are implemented by the device, TypeNetworkVideoTransmitter and
+	// TypeDeviceService when empty
+	Types []DeviceType
+	// Scopes of the device. A scope without scheme is relative to
+	// onvif://www.onvif.org/.
+	Scopes []string
+	// XAddrs are the addresses of the device service
+	XAddrs []string
+	// MetadataVersion must be incremented when Types, Scopes or XAddrs
+	// change
+	MetadataVersion uint32
+	// Interfaces to answer on, every multicast interface when empty
+	Interfaces []net.Interface
+
+	// instanceID and messageNumber form the AppSequence of the messages
+	instanceID    int64
+	messageNumber int
+}
+
+// Serve announces the device with a Hello, then answers the probes and
+// resolves matching it until ctx is done, and finally sends a Bye. Multicast
+// messages are answered after a random delay of up to 500ms, unicast ones at
+// once.
+func (responder *DiscoveryResponder) Serve(ctx context.Context) error {
+	ifaces, err := multicastInterfaces(responder.Interfaces)
+	if err != nil {
+		return err
+	}
+
+	conn, err := listenDiscoveryMulticast(ifaces)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	responder.instanceID = time.Now().Unix()
+	responder.messageNumber = 0
+
+	// Tell multicast messages from unicast ones
+	if err = ipv4.NewPacketConn(conn).SetControlMessage(ipv4.FlagDst, true); err != nil {
+		log.Debugf("Could not read the destination of discovery messages: %v", err)
+	}
+
+	responder.announce(conn, ifaces, "Hello")
+	defer responder.announce(conn, ifaces, "Bye")
+
+	// Answers are sent before the Bye
+	var answers sync.WaitGroup
+	defer answers.Wait()
+
+	// Probes are repeated, answer each one once
+	var seen discoveryMessageIDs
+
+	return readUDP(ctx, conn, func(payload []byte, udpAddr *net.UDPAddr, dst net.IP) bool {
+		envelope, err := parseDiscoveryEnvelope(payload)
+		if err != nil {
+			log.Debugf("Invalid discovery message from %s: %v", udpAddr, err)
+			return false
+		}
+		if seen.repeated(envelope.Header.MessageID) {
+			return false
+		}
+
+		answer := responder.answer(envelope)
+		if answer == "" {
+			return false
+		}
+
+		answers.Add(1)
+		go func() {
+			defer answers.Done()
+
+			timer := time.NewTimer(answerDelay(dst))
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			if _, err := conn.WriteToUDP([]byte(answer), udpAddr); err != nil {
+				log.Warnf("Could not answer discovery message of %s: %v", udpAddr, err)
+			}
+		}()
+		return false
+	})
+}
+
+// answerDelay returns the delay before answering a message sent to dst: a
+// random delay up to appMaxDelay for multicast messages, so the devices of a
+// network do not all answer at once, and none for unicast ones. A message of
+// unknown destination is taken as multicast.
+func answerDelay(dst net.IP) time.Duration {
+	if dst != nil && !dst.IsMulticast() {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(appMaxDelay) + 1))
+}
+
+// answer returns the ProbeMatches or ResolveMatches answering a message, or
+// an empty string when the message is not for the device
+func (responder *DiscoveryResponder) answer(envelope *discoveryEnvelope) string {
+	body := envelope.Body
+	switch {
+	case body.Probe != nil:
+		options := DiscoveryOptions{
+			Scopes:  strings.Fields(body.Probe.Scopes.Value),
+			MatchBy: strings.TrimSpace(body.Probe.Scopes.MatchBy),
+		}
+		for _, name := range strings.Fields(body.Probe.Types) {
+			options.Types = append(options.Types, DeviceType{Name: localName(name)})
+		}
+
+		// Scopes can only be matched by the rules implemented
+		if len(options.Scopes) > 0 && options.MatchBy != "" && options.MatchBy != MatchByRFC3986 && options.MatchBy != MatchByStrcmp0 {
+			return ""
+		}
+		if !options.matches(responder.device()) {
+			return ""
+		}
+		return responder.message("ProbeMatches", envelope.Header.MessageID)
+	case body.Resolve != nil:
+		if strings.TrimSpace(body.Resolve.Address) != endpointAddress(responder.ID) {
+			return ""
+		}
+		return responder.message("ResolveMatches", envelope.Header.MessageID)
+	}
+	return ""
+}
+
+// announce multicasts a Hello or Bye on each interface
+func (responder *DiscoveryResponder) announce(conn *net.UDPConn, ifaces []net.Interface, action string) {
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702}
+	message := []byte(responder.message(action, ""))
+
+	// Listeners of this host hear the announcements too
+	packetConn := ipv4.NewPacketConn(conn)
+	if err := packetConn.SetMulticastLoopback(true); err != nil {
+		log.Debugf("Could not enable multicast loopback: %v", err)
+	}
+
+	for _, iface := range ifaces {
+		iface := iface
+		if err := packetConn.SetMulticastInterface(&iface); err != nil {
+			log.Warnf("Could not send %s on %s: %v", action, iface.Name, err)
+			continue
+		}
+		if _, err := conn.WriteToUDP(message, group); err != nil {
+			log.Warnf("Could not send %s on %s: %v", action, iface.Name, err)
+		}
+	}
+}
+
+// device returns the Device described by the responder, to match probes
+func (responder *DiscoveryResponder) device() *Device {
+	device := &Device{Scopes: absoluteScopes(responder.Scopes)}
+	for _, deviceType := range responder.types() {
+		device.Types = append(device.Types, deviceType.Name)
+	}
+	return device
+}
+
+// types returns the types implemented by the device
+func (responder *DiscoveryResponder) types() []DeviceType {
+	if len(responder.Types) == 0 {
+		return []DeviceType{TypeNetworkVideoTransmitter, TypeDeviceService}
+	}
+	return responder.Types
+}
+
+// message returns a Hello, Bye, ProbeMatches or ResolveMatches message
+// describing the device. relatesTo is the ID of the message answered.
+func (responder *DiscoveryResponder) message(action, relatesTo string) string {
+	responder.messageNumber++
+
+	to := "urn:schemas-xmlsoap-org:ws:2005:04:discovery"
+	var relation string
+	if relatesTo != "" {
+		to = "http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous"
+		relation = `<a:RelatesTo>` + escapeXML(relatesTo) + `</a:RelatesTo>`
+	}
+
+	// A Bye only identifies the device
+	description := `<a:EndpointReference><a:Address>` + escapeXML(endpointAddress(responder.ID)) + `</a:Address></a:EndpointReference>`
+	if action != "Bye" {
+		description += typesElement(responder.types()) +
+			`<d:Scopes>` + escapeXML(strings.Join(absoluteScopes(responder.Scopes), " ")) + `</d:Scopes>` +
+			`<d:XAddrs>` + escapeXML(strings.Join(responder.XAddrs, " ")) + `</d:XAddrs>` +
+			`<d:MetadataVersion>` + strconv.FormatUint(uint64(responder.MetadataVersion), 10) + `</d:MetadataVersion>`
+	}
+
+	var body string
+	switch action {
+	case "ProbeMatches":
+		body = `<d:ProbeMatches><d:ProbeMatch>` + description + `</d:ProbeMatch></d:ProbeMatches>`
+	case "ResolveMatches":
+		body = `<d:ResolveMatches><d:ResolveMatch>` + description + `</d:ResolveMatch></d:ResolveMatches>`
+	default:
+		body = `<d:` + action + `>` + description + `</d:` + action + `>`
+	}
+
+	var message = `
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+  <s:Header>
+    <a:Action s:mustUnderstand="1">http://schemas.xmlsoap.org/ws/2005/04/discovery/` + action + `</a:Action>
+    <a:MessageID>` + newMessageID() + `</a:MessageID>
+    ` + relation + `
+    <a:To s:mustUnderstand="1">` + to + `</a:To>
+    <d:AppSequence InstanceId="` + strconv.FormatInt(responder.instanceID, 10) + `" MessageNumber="` + strconv.Itoa(responder.messageNumber) + `"/>
+  </s:Header>
+  <s:Body>` + body + `</s:Body>
+</s:Envelope>
+`
+	return cleanDiscoveryMessage(message)
+}
@@ -0,0 +1,111 @@
+package onvif
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryResponder(t *testing.T) {
+	ipAddr := localIPv4(t)
+	addrs := []net.Addr{ipAddr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, err := ListenDiscoveryEvents(ctx, nil)
+	if err != nil {
+		t.Skipf("cannot join the WS-Discovery group: %v", err)
+	}
+
+	responder := &DiscoveryResponder{
+		ID:              "5f0c2e1a-7a3b-4c1d-9e2f-0123456789ab",
+		Scopes:          []string{"name/Test%20Rig", "location/building-7", "Profile/Streaming"},
+		XAddrs:          []string{"http://" + ipAddr.IP.String() + "/onvif/device_service"},
+		MetadataVersion: 2,
+	}
+	serveCtx, stop := context.WithCancel(ctx)
+	served := make(chan error, 1)
+	go func() {
+		served <- responder.Serve(serveCtx)
+	}()
+
+	event := nextDiscoveryEvent(t, ctx, events)
+	if event.Type != DeviceHello || event.Device.ID != responder.ID || event.Device.MetadataVersion != 2 {
+		t.Fatalf("unexpected Hello %v %+v", event.Type, event.Device)
+	}
+
+	// Probe
+	devices, err := StartDiscoveryWithContext(ctx, addrs, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("expected 1 device, got %d", len(devices))
+	}
+	device := devices[0]
+	if device.ID != responder.ID || device.XAddr != responder.XAddrs[0] || device.Name != "Test Rig" {
+		t.Errorf("unexpected device %+v", device)
+	}
+	if !device.ParsedScopes.HasProfile("S") || len(device.Types) != 2 {
+		t.Errorf("unexpected types %v and scopes %v", device.Types, device.Scopes)
+	}
+
+	// Probe not matching the scopes
+	probeCtx, cancelProbe := context.WithTimeout(ctx, 500*time.Millisecond)
+	devices, err = StartDiscoveryWithOptions(probeCtx, addrs, DiscoveryOptions{Scopes: []string{"location/building-8"}})
+	cancelProbe()
+	if err != nil || len(devices) != 0 {
+		t.Errorf("expected no device in another location, got %v, %v", devices, err)
+	}
+
+	// Resolve
+	resolveCtx, cancelResolve := context.WithTimeout(ctx, time.Second)
+	device, err = Resolve(resolveCtx, responder.ID, addrs)
+	cancelResolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(device.XAddrs) != 1 || device.XAddrs[0] != responder.XAddrs[0] {
+		t.Errorf("unexpected resolved XAddrs %v", device.XAddrs)
+	}
+
+	stop()
+	if err = <-served; err != nil {
+		t.Fatal(err)
+	}
+	if event = nextDiscoveryEvent(t, ctx, events); event.Type != DeviceBye || event.Device.ID != responder.ID {
+		t.Errorf("unexpected Bye %v %+v", event.Type, event.Device)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+// nextDiscoveryEvent waits for an event until ctx is done
+func nextDiscoveryEvent(t *testing.T, ctx context.Context, events <-chan DiscoveryEvent) DiscoveryEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-ctx.Done():
+		t.Fatal("no discovery event received")
+	}
+	return DiscoveryEvent{}
+}
+
+func TestAnswerDelay(t *testing.T) {
+	for _, dst := range []net.IP{net.IPv4(127, 0, 0, 1), net.IPv4(192, 168, 1, 10)} {
+		if delay := answerDelay(dst); delay != 0 {
+			t.Errorf("%s: expected no delay, got %v", dst, delay)
+		}
+	}
+	for _, dst := range []net.IP{net.IPv4(239, 255, 255, 250), nil} {
+		for i := 0; i < 100; i++ {
+			if delay := answerDelay(dst); delay < 0 || delay > appMaxDelay {
+				t.Fatalf("%s: delay %v out of [0, %v]", dst, delay, appMaxDelay)
+			}
+		}
+	}
+}
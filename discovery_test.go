@@ -1,8 +1,11 @@
 package onvif
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestDiscoveryUnionCamQ5CamKeeper(t *testing.T) {
@@ -57,8 +60,179 @@ func TestDiscoveryUnionCamQ5CamKeeper(t *testing.T) {
 		return
 	}
 
-	if dev[0].XAddr != "http://10.0.101.213:8090/onvif/device_service" {
+	if len(dev) != 1 || len(dev[0].XAddrs) != 1 || dev[0].XAddrs[0] != "http://10.0.101.213:8090/onvif/device_service" {
 		fmt.Println("XAddr does not match")
 		t.FailNow()
 	}
+	if dev[0].ID != "A000734" || dev[0].Name != "CamKeeper" || dev[0].MetadataVersion != 10 {
+		t.Errorf("unexpected device %+v", dev[0])
+	}
+}
+
+func TestDiscoveryMultipleMatches(t *testing.T) {
+	const resp = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"
+xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<s:Header><a:RelatesTo>uuid:1</a:RelatesTo></s:Header>
+<s:Body><d:ProbeMatches>
+<d:ProbeMatch>
+	<a:EndpointReference><a:Address>urn:uuid:nvr-channel-1</a:Address></a:EndpointReference>
+	<d:Types>dn:NetworkVideoTransmitter tds:Device</d:Types>
+	<d:XAddrs>https://[2001:db8::10]/onvif/device_service http://192.168.1.10/onvif/device_service https://192.168.1.10/onvif/device_service http://192.168.1.10/onvif/device_service</d:XAddrs>
+	<d:MetadataVersion>3</d:MetadataVersion>
+</d:ProbeMatch>
+<d:ProbeMatch>
+	<a:EndpointReference><a:Address>urn:uuid:nvr-channel-2</a:Address></a:EndpointReference>
+	<d:XAddrs>http://192.168.1.10:8002/onvif/device_service</d:XAddrs>
+</d:ProbeMatch>
+</d:ProbeMatches></s:Body></s:Envelope>`
+
+	devices, err := readDiscoveryResponse("uuid:1", []byte(resp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(devices))
+	}
+
+	first := devices[0]
+	if first.ID != "nvr-channel-1" || len(first.Types) != 2 || first.MetadataVersion != 3 {
+		t.Errorf("unexpected device %+v", first)
+	}
+	if len(first.XAddrs) != 3 {
+		t.Errorf("expected duplicate XAddrs to be merged, got %v", first.XAddrs)
+	}
+	if xAddr := PreferredXAddr(first.XAddrs, nil); xAddr != "http://192.168.1.10/onvif/device_service" {
+		t.Errorf("unexpected preferred XAddr %s", xAddr)
+	}
+
+	// The choice does not depend on the order of the addresses
+	reversed := []string{first.XAddrs[2], first.XAddrs[1], first.XAddrs[0]}
+	if PreferredXAddr(reversed, nil) != PreferredXAddr(first.XAddrs, nil) {
+		t.Error("preferred XAddr depends on the order of XAddrs")
+	}
+
+	_, subnet, _ := net.ParseCIDR("2001:db8::/64")
+	if xAddr := PreferredXAddr(first.XAddrs, subnet); xAddr != "https://[2001:db8::10]/onvif/device_service" {
+		t.Errorf("unexpected preferred XAddr in %s: %s", subnet, xAddr)
+	}
+
+	if devices[1].ID != "nvr-channel-2" || len(devices[1].XAddrs) != 1 {
+		t.Errorf("unexpected device %+v", devices[1])
+	}
+}
+
+// localIPv4 returns an IPv4 interface address usable for discovery
+func localIPv4(t *testing.T) *net.IPNet {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range addrs {
+		if ipAddr, ok := addr.(*net.IPNet); ok && !ipAddr.IP.IsLoopback() && ipAddr.IP.To4() != nil {
+			return ipAddr
+		}
+	}
+	t.Skip("no IPv4 interface address")
+	return nil
+}
+
+func TestDiscoveryContextCancel(t *testing.T) {
+	ipAddr := localIPv4(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// An address that is not ours fails to bind, without aborting the
+	// discovery on the other interface
+	unbound := &net.IPNet{IP: net.ParseIP("203.0.113.77"), Mask: net.CIDRMask(24, 32)}
+
+	start := time.Now()
+	devices, err := StartDiscoveryWithContext(ctx, []net.Addr{unbound, ipAddr}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("discovery was not stopped by the context, took %s", elapsed)
+	}
+	if devices == nil {
+		t.Error("expected an empty result, got nil")
+	}
+
+	if _, err = StartDiscoveryWithContext(context.Background(), []net.Addr{unbound}, time.Second); err == nil {
+		t.Error("expected an error when every interface fails")
+	}
+}
+
+func TestStreamDiscoveryClosed(t *testing.T) {
+	ipAddr := localIPv4(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	devices := StreamDiscovery(ctx, []net.Addr{ipAddr})
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context was not done")
+	}
+
+	select {
+	case _, ok := <-devices:
+		for ok {
+			_, ok = <-devices
+		}
+	case <-time.After(time.Second):
+		t.Error("channel was not closed when the context ended")
+	}
+}
+
+func TestDiscoverySubnetXAddrIPv6(t *testing.T) {
+	xAddrs := []string{
+		"http://192.168.1.10/onvif/device_service",
+		"http://[2001:db8:7::10]/onvif/device_service",
+		"http://[fe80::10]:8080/onvif/device_service",
+	}
+
+	_, subnet, _ := net.ParseCIDR("2001:db8:7::/64")
+	xAddr, ok := subnetXAddr(xAddrs, subnet, "eth1")
+	if !ok || xAddr != "http://[2001:db8:7::10]/onvif/device_service" {
+		t.Errorf("unexpected XAddr in %s: %s", subnet, xAddr)
+	}
+
+	_, subnet, _ = net.ParseCIDR("fe80::/64")
+	xAddr, ok = subnetXAddr(xAddrs, subnet, "eth1")
+	if !ok || xAddr != "http://[fe80::10%25eth1]:8080/onvif/device_service" {
+		t.Errorf("link-local XAddr is not scoped to its interface: %s", xAddr)
+	}
+
+	_, subnet, _ = net.ParseCIDR("2001:db8:8::/64")
+	if xAddr, ok = subnetXAddr(xAddrs, subnet, "eth1"); ok {
+		t.Errorf("unexpected XAddr outside of %s: %s", subnet, xAddr)
+	}
+}
+
+func TestDiscoveryIPv6Probe(t *testing.T) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ipAddr *net.IPNet
+	for _, addr := range addrs {
+		if ip, ok := addr.(*net.IPNet); ok && !ip.IP.IsLoopback() && ip.IP.To4() == nil {
+			ipAddr = ip
+			break
+		}
+	}
+	if ipAddr == nil {
+		t.Skip("no IPv6 interface address")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err = discoverDevices(ctx, ipAddr, DiscoveryOptions{}, DiscoveryOptions{}.probeMessage, func(*Device) {}); err != nil {
+		t.Errorf("probe from %s failed: %v", ipAddr, err)
+	}
 }
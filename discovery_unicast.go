@@ -0,0 +1,224 @@
+package onvif
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// discoveryPort is the WS-Discovery UDP port
+const discoveryPort = "3702"
+
+// maxSweepHosts limits the size of a range probed by SweepSubnet
+const maxSweepHosts = 1 << 16
+
+// defaultSweepConcurrency is the number of probes SweepSubnet runs at a time
+// when none is given
+const defaultSweepConcurrency = 64
+
+// ProbeHost sends a WS-Discovery Probe by unicast to host, an IP address or
+// host name, and returns the devices of its answer. It waits for the answer
+// until ctx is done, or for DefaultTimeout when ctx has no deadline.
+func ProbeHost(ctx context.Context, host string) ([]*Device, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	return unicastDiscovery(ctx, net.JoinHostPort(host, discoveryPort), UnicastUDPRepeat, DiscoveryOptions{}.probeMessage)
+}
+
+// SweepSubnet probes every host of the cidr range by unicast, running at
+// most concurrency probes at a time and waiting timeout for each answer.
+// concurrency defaults to 64 and timeout to DefaultTimeout when not
+// positive. Network and broadcast addresses of IPv4 ranges are skipped. A device
+// answering on several addresses is returned once.
+func SweepSubnet(ctx context.Context, cidr string, concurrency int, timeout time.Duration) ([]*Device, error) {
+	hosts, err := subnetHosts(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if concurrency <= 0 {
+		concurrency = defaultSweepConcurrency
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	seen := make(map[string]bool)
+	discoveryResults := []*Device{}
+
+	semaphore := make(chan struct{}, concurrency)
+	for _, host := range hosts {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			probeCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			devices, err := unicastDiscovery(probeCtx, net.JoinHostPort(host, discoveryPort), UnicastUDPRepeat, DiscoveryOptions{}.probeMessage)
+			if err != nil {
+				log.Debugf("Probe of %s failed: %v", host, err)
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, device := range devices {
+				if device.ID != "" && seen[device.ID] {
+					continue
+				}
+				seen[device.ID] = true
+				discoveryResults = append(discoveryResults, device)
+			}
+		}(host)
+	}
+	wg.Wait()
+
+	return discoveryResults, ctx.Err()
+}
+
+// Resolve multicasts a WS-Discovery Resolve for endpoint, a device ID or
+// endpoint address, from each address of addrs and returns the device with
+// its current XAddrs. It waits until ctx is done for an answer.
+func Resolve(ctx context.Context, endpoint string, addrs []net.Addr) (*Device, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	address := endpointAddress(endpoint)
+	request := func(messageID string) string {
+		return resolveMessage(messageID, address)
+	}
+
+	var resolved *Device
+	err := discover(ctx, addrs, DiscoveryOptions{}, request, func(device *Device) {
+		if resolved == nil && endpointAddress(device.ID) == address {
+			resolved = device
+			cancel()
+		}
+	})
+	if resolved != nil {
+		return resolved, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.Errorf("No device resolved %s", endpoint)
+}
+
+// unicastDiscovery sends the WS-Discovery message built by request to the
+// host:port target, retransmitting it repeat times until answered, and
+// returns the devices of the first answer
+func unicastDiscovery(ctx context.Context, target string, repeat int, request func(messageID string) string) ([]*Device, error) {
+	messageID := newMessageID()
+
+	address, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create UDP connection
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Send WS-Discovery request, and repeat it as UDP datagrams may be lost
+	message := []byte(request(messageID))
+	if _, err = conn.WriteToUDP(message, address); err != nil {
+		return nil, err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go repeatUDP(conn, message, address, repeat, stop)
+
+	var result []*Device
+	err = readDiscoveryMatches(ctx, conn, messageID, func(devices []*Device, udpAddr *net.UDPAddr) bool {
+		// Prefer the XAddr of the address that answered
+		sender := &net.IPNet{IP: udpAddr.IP, Mask: net.CIDRMask(len(udpAddr.IP)*8, len(udpAddr.IP)*8)}
+		for _, device := range devices {
+			device.XAddr = PreferredXAddr(device.XAddrs, sender)
+			device.IPAddress = udpAddr.IP.String()
+		}
+
+		result = devices
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, errors.Wrapf(ctx.Err(), "No WS-Discovery answer from %s", target)
+	}
+
+	return result, nil
+}
+
+// subnetHosts lists the host addresses of a CIDR range
+func subnetHosts(cidr string) ([]string, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones > 16 {
+		return nil, errors.Errorf("Range %s has more than %d addresses", cidr, maxSweepHosts)
+	}
+	size := 1 << uint(bits-ones)
+
+	first := 0
+	last := size - 1
+	if ip.To4() != nil && size > 2 {
+		// Skip the network and broadcast addresses
+		first, last = 1, size-2
+	}
+
+	base := new(big.Int).SetBytes(ipNet.IP)
+	hosts := make([]string, 0, last-first+1)
+	for offset := first; offset <= last; offset++ {
+		hosts = append(hosts, offsetIP(base, offset, len(ipNet.IP)).String())
+	}
+
+	return hosts, nil
+}
+
+// offsetIP returns the IP address base + offset, on length bytes
+func offsetIP(base *big.Int, offset, length int) net.IP {
+	value := new(big.Int).Add(base, big.NewInt(int64(offset))).Bytes()
+
+	ip := make(net.IP, length)
+	copy(ip[length-len(value):], value)
+	return ip
+}
+
+// endpointAddress returns the WS-Addressing address of a device ID, which
+// is stripped of its urn:uuid: prefix
+func endpointAddress(id string) string {
+	id = strings.TrimSpace(id)
+	if strings.Contains(id, ":") {
+		return id
+	}
+	return "urn:uuid:" + id
+}
@@ -0,0 +1,178 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDiscoveryResponder answers each WS-Discovery message received on a
+// loopback port with a single match, built from the action of the message
+func fakeDiscoveryResponder(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		buffer := make([]byte, 16*1024)
+		for {
+			n, udpAddr, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			envelope, err := parseDiscoveryEnvelope(buffer[:n])
+			if err != nil {
+				continue
+			}
+
+			match := "ProbeMatch"
+			if strings.HasSuffix(envelope.Header.Action, "/Resolve") {
+				match = "ResolveMatch"
+			}
+			conn.WriteToUDP([]byte(fmt.Sprintf(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"
+xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<s:Header><a:RelatesTo>%s</a:RelatesTo></s:Header>
+<s:Body><d:%[2]ses><d:%[2]s>
+	<a:EndpointReference><a:Address>urn:uuid:routed-camera</a:Address></a:EndpointReference>
+	<d:Types>dn:NetworkVideoTransmitter</d:Types>
+	<d:Scopes>onvif://www.onvif.org/name/Routed</d:Scopes>
+	<d:XAddrs>http://[2001:db8::20]/onvif/device_service http://127.0.0.1/onvif/device_service</d:XAddrs>
+	<d:MetadataVersion>1</d:MetadataVersion>
+</d:%[2]s></d:%[2]ses></s:Body></s:Envelope>`, envelope.Header.MessageID, match)), udpAddr)
+		}
+	}()
+
+	return conn
+}
+
+func TestDiscoveryUnicast(t *testing.T) {
+	responder := fakeDiscoveryResponder(t)
+	defer responder.Close()
+	target := responder.LocalAddr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	devices, err := unicastDiscovery(ctx, target, UnicastUDPRepeat, DiscoveryOptions{}.probeMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("expected 1 device, got %d", len(devices))
+	}
+	device := devices[0]
+	if device.ID != "routed-camera" || device.Name != "Routed" {
+		t.Errorf("unexpected device %+v", device)
+	}
+	if device.XAddr != "http://127.0.0.1/onvif/device_service" || device.IPAddress != "127.0.0.1" {
+		t.Errorf("expected the XAddr of the answering address, got %s from %s", device.XAddr, device.IPAddress)
+	}
+
+	resolve := func(messageID string) string {
+		return resolveMessage(messageID, endpointAddress("routed-camera"))
+	}
+	devices, err = unicastDiscovery(ctx, target, UnicastUDPRepeat, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].ID != "routed-camera" || len(devices[0].XAddrs) != 2 {
+		t.Errorf("unexpected resolve answer %+v", devices)
+	}
+}
+
+func TestDiscoveryUnicastTimeout(t *testing.T) {
+	// A bound socket which never answers
+	silent, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := unicastDiscovery(ctx, silent.LocalAddr().String(), UnicastUDPRepeat, DiscoveryOptions{}.probeMessage); err == nil {
+		t.Error("expected an error without answer")
+	}
+}
+
+func TestDiscoveryUnicastRepeat(t *testing.T) {
+	silent, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	// The retransmissions are over after 250ms and 500ms at most
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go unicastDiscovery(ctx, silent.LocalAddr().String(), UnicastUDPRepeat, DiscoveryOptions{}.probeMessage)
+
+	received := 0
+	buffer := make([]byte, 16*1024)
+	silent.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := silent.ReadFromUDP(buffer); err != nil {
+			break
+		}
+		received++
+	}
+	if received != 1+UnicastUDPRepeat {
+		t.Errorf("expected %d probes, got %d", 1+UnicastUDPRepeat, received)
+	}
+
+	for repeat, expected := range map[int]int{0: UnicastUDPRepeat, -1: 0, 5: 5} {
+		if got := (DiscoveryOptions{Repeat: repeat}).unicastRepeat(); got != expected {
+			t.Errorf("Repeat %d: expected %d unicast retransmissions, got %d", repeat, expected, got)
+		}
+	}
+}
+
+func TestDiscoverySubnetHosts(t *testing.T) {
+	tests := map[string][]string{
+		"192.0.2.8/30":     {"192.0.2.9", "192.0.2.10"},
+		"192.0.2.8/31":     {"192.0.2.8", "192.0.2.9"},
+		"192.0.2.255/32":   {"192.0.2.255"},
+		"10.0.0.255/23":    nil,
+		"2001:db8::/127":   {"2001:db8::", "2001:db8::1"},
+		"192.0.2.254/24":   nil,
+		"2001:db8::ff/120": nil,
+	}
+	for cidr, expected := range tests {
+		hosts, err := subnetHosts(cidr)
+		if err != nil {
+			t.Errorf("%s: %v", cidr, err)
+			continue
+		}
+		if expected != nil && !reflect.DeepEqual(hosts, expected) {
+			t.Errorf("%s: expected %v, got %v", cidr, expected, hosts)
+		}
+	}
+
+	if hosts, _ := subnetHosts("10.0.0.255/23"); len(hosts) != 510 || hosts[0] != "10.0.0.1" || hosts[509] != "10.0.1.254" {
+		t.Errorf("unexpected /23 hosts %d %v", len(hosts), hosts[:1])
+	}
+	if hosts, _ := subnetHosts("2001:db8::ff/120"); len(hosts) != 256 || hosts[255] != "2001:db8::ff" {
+		t.Errorf("unexpected /120 hosts %d", len(hosts))
+	}
+	if _, err := subnetHosts("10.0.0.0/8"); err == nil {
+		t.Error("expected an error for a /8 range")
+	}
+}
+
+func TestDiscoveryEndpointAddress(t *testing.T) {
+	for id, expected := range map[string]string{
+		"0a1b2c3d-0000-1111-2222-333344445555":          "urn:uuid:0a1b2c3d-0000-1111-2222-333344445555",
+		"urn:uuid:0a1b2c3d-0000-1111-2222-333344445555": "urn:uuid:0a1b2c3d-0000-1111-2222-333344445555",
+		"http://camera.example/device":                  "http://camera.example/device",
+	} {
+		if address := endpointAddress(id); address != expected {
+			t.Errorf("%s: expected %s, got %s", id, expected, address)
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package onvif
 
-import "fmt"
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
 
 type OnvifErr struct {
 	subCode string
@@ -30,3 +36,245 @@ func NewUnsupportedError(subCode, detail string) ErrNewUnsupportedError {
 func (e ErrNewUnsupportedError) Error() string {
 	return fmt.Sprintf("%s: %s", e.subCode, e.Detail)
 }
+
+// Sentinel errors matched by a Fault carrying the corresponding ter: subcode
+var (
+	ErrNotAuthorized      = errors.New("onvif: not authorized")
+	ErrActionNotSupported = errors.New("onvif: action not supported")
+	ErrInvalidArgVal      = errors.New("onvif: invalid argument value")
+	ErrInvalidArgs        = errors.New("onvif: invalid arguments")
+	ErrActionFailed       = errors.New("onvif: action failed")
+	ErrFixedScope         = errors.New("onvif: fixed scope")
+	ErrNoScope            = errors.New("onvif: no such scope")
+	ErrTooManyScopes      = errors.New("onvif: too many scopes")
+)
+
+// Sentinel errors matched by the faults of user management, mostly password
+// policy violations
+var (
+	ErrUsernameClash       = errors.New("onvif: username already exists")
+	ErrUsernameTooShort    = errors.New("onvif: username too short")
+	ErrUsernameTooLong     = errors.New("onvif: username too long")
+	ErrUsernameMissing     = errors.New("onvif: username not found")
+	ErrPasswordTooWeak     = errors.New("onvif: password too weak")
+	ErrPasswordTooLong     = errors.New("onvif: password too long")
+	ErrTooManyUsers        = errors.New("onvif: too many users")
+	ErrAnonymousNotAllowed = errors.New("onvif: anonymous user not allowed")
+	ErrFixedUser           = errors.New("onvif: fixed user")
+)
+
+// ErrServiceNotSupported is returned when the device does not expose the
+// service a method needs
+var ErrServiceNotSupported = errors.New("onvif: service not supported")
+
+// ErrRebootNotObserved is returned when a camera answered every poll while
+// waiting for it to reboot, as when it ignored the reboot request
+var ErrRebootNotObserved = errors.New("onvif: reboot not observed")
+
+// ErrFirmwareNotApplied is returned when a camera does not report the
+// expected firmware version after an upgrade
+var ErrFirmwareNotApplied = errors.New("onvif: firmware not applied")
+
+// ErrInvalidResponse is returned when a response can not be decoded or
+// lacks a required element
+var ErrInvalidResponse = errors.New("onvif: invalid response")
+
+var faultSentinels = map[error]string{
+	ErrNotAuthorized:      "NotAuthorized",
+	ErrActionNotSupported: "ActionNotSupported",
+	ErrInvalidArgVal:      "InvalidArgVal",
+	ErrInvalidArgs:        "InvalidArgs",
+	ErrActionFailed:       "Action",
+	ErrFixedScope:         "FixedScope",
+	ErrNoScope:            "NoScope",
+	ErrTooManyScopes:      "TooManyScopes",
+
+	ErrUsernameClash:       "UsernameClash",
+	ErrUsernameTooShort:    "UsernameTooShort",
+	ErrUsernameTooLong:     "UsernameTooLong",
+	ErrUsernameMissing:     "UsernameMissing",
+	ErrPasswordTooWeak:     "Password",
+	ErrPasswordTooLong:     "PasswordTooLong",
+	ErrTooManyUsers:        "TooManyUsers",
+	ErrAnonymousNotAllowed: "AnonymousNotAllowed",
+	ErrFixedUser:           "FixedUser",
+}
+
+// Fault is a SOAP fault returned by an ONVIF device
+type Fault struct {
+	// Code is the top level fault code, e.g. env:Sender or env:Receiver
+	Code string
+	// Subcodes is the subcode chain from outermost to innermost,
+	// e.g. ter:InvalidArgVal, ter:NoProfile
+	Subcodes []string
+	Reason   string
+	Detail   string
+	// StatusCode is the HTTP status of the response carrying the fault
+	StatusCode int
+}
+
+func (f *Fault) Error() string {
+	codes := f.Subcodes
+	if len(codes) == 0 {
+		codes = []string{f.Code}
+	}
+
+	msg := strings.Join(codes, "/")
+	if f.Reason != "" {
+		msg += ": " + f.Reason
+	}
+
+	return msg
+}
+
+// HasSubcode reports whether the fault's subcode chain contains subcode.
+// The namespace prefix is ignored on both sides.
+func (f *Fault) HasSubcode(subcode string) bool {
+	subcode = localName(subcode)
+	for _, code := range f.Subcodes {
+		if localName(code) == subcode {
+			return true
+		}
+	}
+	return false
+}
+
+// Is allows matching a fault against the sentinel errors with errors.Is
+func (f *Fault) Is(target error) bool {
+	subcode, ok := faultSentinels[target]
+	if !ok {
+		return false
+	}
+	if target == ErrNotAuthorized && f.StatusCode == 401 {
+		return true
+	}
+	return f.HasSubcode(subcode)
+}
+
+// As allows converting a fault to ErrOperationProhibited or
+// ErrNewUnsupportedError with errors.As
+func (f *Fault) As(target interface{}) bool {
+	switch target := target.(type) {
+	case *ErrOperationProhibited:
+		if f.HasSubcode("OperationProhibited") {
+			*target = NewErrOperationProhibited(f.message())
+			return true
+		}
+	case *ErrNewUnsupportedError:
+		for _, code := range f.Subcodes {
+			if strings.HasSuffix(localName(code), "NotSupported") {
+				*target = NewUnsupportedError(localName(code), f.message())
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// message returns the most descriptive text of the fault
+func (f *Fault) message() string {
+	if f.Detail != "" {
+		return f.Detail
+	}
+	return f.Reason
+}
+
+type faultCode struct {
+	Value   string     `xml:"Value"`
+	Subcode *faultCode `xml:"Subcode"`
+}
+
+type faultText struct {
+	Inner []byte `xml:",innerxml"`
+}
+
+type faultEnvelope struct {
+	Body struct {
+		Fault *struct {
+			// SOAP 1.2
+			Code   faultCode `xml:"Code"`
+			Reason struct {
+				Text []string `xml:"Text"`
+			} `xml:"Reason"`
+			Detail faultText `xml:"Detail"`
+
+			// SOAP 1.1
+			FaultCode   string    `xml:"faultcode"`
+			FaultString string    `xml:"faultstring"`
+			FaultDetail faultText `xml:"detail"`
+		} `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+// genericFaultCodes are the fault codes defined by SOAP 1.1 and 1.2
+var genericFaultCodes = map[string]bool{
+	"VersionMismatch":     true,
+	"MustUnderstand":      true,
+	"DataEncodingUnknown": true,
+	"Client":              true,
+	"Server":              true,
+	"Sender":              true,
+	"Receiver":            true,
+}
+
+// parseFault returns the SOAP fault contained in body, or nil if there is none
+func parseFault(body []byte) *Fault {
+	var envelope faultEnvelope
+	if err := xml.Unmarshal(body, &envelope); err != nil || envelope.Body.Fault == nil {
+		return nil
+	}
+	soapFault := envelope.Body.Fault
+
+	fault := &Fault{}
+	if soapFault.FaultCode != "" {
+		fault.Code = strings.TrimSpace(soapFault.FaultCode)
+		fault.Reason = strings.TrimSpace(soapFault.FaultString)
+		fault.Detail = xmlText(soapFault.FaultDetail.Inner)
+
+		// SOAP 1.1 has no subcodes, devices send the ter: code as the
+		// faultcode instead of a generic one
+		if !genericFaultCodes[localName(fault.Code)] {
+			fault.Subcodes = []string{fault.Code}
+		}
+		return fault
+	}
+
+	fault.Code = strings.TrimSpace(soapFault.Code.Value)
+	for subcode := soapFault.Code.Subcode; subcode != nil; subcode = subcode.Subcode {
+		fault.Subcodes = append(fault.Subcodes, strings.TrimSpace(subcode.Value))
+	}
+	if len(soapFault.Reason.Text) > 0 {
+		fault.Reason = strings.TrimSpace(soapFault.Reason.Text[0])
+	}
+	fault.Detail = xmlText(soapFault.Detail.Inner)
+
+	return fault
+}
+
+// xmlText returns the character data of an XML fragment, ignoring markup
+func xmlText(fragment []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(fragment))
+
+	var texts []string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if charData, ok := token.(xml.CharData); ok {
+			if text := strings.TrimSpace(string(charData)); text != "" {
+				texts = append(texts, text)
+			}
+		}
+	}
+
+	return strings.Join(texts, " ")
+}
+
+// localName strips the namespace prefix of a qualified name
+func localName(name string) string {
+	if idx := strings.LastIndex(name, ":"); idx >= 0 {
+		return name[idx+1:]
+	}
+	return name
+}
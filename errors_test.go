@@ -0,0 +1,119 @@
+package onvif
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const invalidArgFault = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:ter="http://www.onvif.org/ver10/error">
+<env:Body>
+	<env:Fault>
+		<env:Code>
+			<env:Value>env:Sender</env:Value>
+			<env:Subcode>
+				<env:Value>ter:InvalidArgVal</env:Value>
+				<env:Subcode><env:Value>ter:NoProfile</env:Value></env:Subcode>
+			</env:Subcode>
+		</env:Code>
+		<env:Reason><env:Text xml:lang="en">Profile token does not exist</env:Text></env:Reason>
+		<env:Detail><env:Text>No profile with token Profile_9</env:Text></env:Detail>
+	</env:Fault>
+</env:Body>
+</env:Envelope>`
+
+func TestParseFault(t *testing.T) {
+	fault := parseFault([]byte(invalidArgFault))
+	if fault == nil {
+		t.Fatal("fault was not parsed")
+	}
+
+	if fault.Code != "env:Sender" {
+		t.Errorf("unexpected code %q", fault.Code)
+	}
+	if len(fault.Subcodes) != 2 || fault.Subcodes[0] != "ter:InvalidArgVal" || fault.Subcodes[1] != "ter:NoProfile" {
+		t.Errorf("unexpected subcodes %v", fault.Subcodes)
+	}
+	if fault.Reason != "Profile token does not exist" {
+		t.Errorf("unexpected reason %q", fault.Reason)
+	}
+	if fault.Detail != "No profile with token Profile_9" {
+		t.Errorf("unexpected detail %q", fault.Detail)
+	}
+
+	if !errors.Is(fault, ErrInvalidArgVal) {
+		t.Error("fault should match ErrInvalidArgVal")
+	}
+	if errors.Is(fault, ErrNotAuthorized) {
+		t.Error("fault should not match ErrNotAuthorized")
+	}
+}
+
+func TestParseFaultSOAP11(t *testing.T) {
+	envelope := func(code string) []byte {
+		return []byte(`<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ter="http://www.onvif.org/ver10/error">
+<SOAP-ENV:Body><SOAP-ENV:Fault><faultcode>` + code + `</faultcode><faultstring>Sender not authorized</faultstring>
+</SOAP-ENV:Fault></SOAP-ENV:Body></SOAP-ENV:Envelope>`)
+	}
+
+	fault := parseFault(envelope("ter:NotAuthorized"))
+	if fault == nil {
+		t.Fatal("fault was not parsed")
+	}
+	if fault.Code != "ter:NotAuthorized" || fault.Reason != "Sender not authorized" {
+		t.Errorf("unexpected fault %+v", fault)
+	}
+	if !errors.Is(fault, ErrNotAuthorized) {
+		t.Error("fault should match ErrNotAuthorized")
+	}
+
+	fault = parseFault(envelope("SOAP-ENV:Client"))
+	if fault == nil {
+		t.Fatal("fault was not parsed")
+	}
+	if len(fault.Subcodes) != 0 || errors.Is(fault, ErrNotAuthorized) {
+		t.Errorf("generic fault should have no subcode, got %v", fault.Subcodes)
+	}
+}
+
+func TestFaultAs(t *testing.T) {
+	fault := &Fault{
+		Code:     "env:Receiver",
+		Subcodes: []string{"ter:ActionNotSupported", "ter:NoImagingForSource"},
+		Reason:   "Imaging is not supported",
+	}
+
+	var unsupported ErrNewUnsupportedError
+	if !errors.As(fault, &unsupported) {
+		t.Fatal("fault should convert to ErrNewUnsupportedError")
+	}
+	if unsupported.Error() != "ActionNotSupported: Imaging is not supported" {
+		t.Errorf("unexpected error %q", unsupported.Error())
+	}
+
+	var prohibited ErrOperationProhibited
+	if errors.As(fault, &prohibited) {
+		t.Error("fault should not convert to ErrOperationProhibited")
+	}
+}
+
+func TestSendRequestFault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		w.Write([]byte(invalidArgFault))
+	}))
+	defer server.Close()
+
+	soap := SOAP{Request: getProfiles{}}
+	_, err := soap.SendRequest(server.URL)
+
+	var fault *Fault
+	if !errors.As(err, &fault) {
+		t.Fatalf("expected a Fault, got %v", err)
+	}
+	if fault.StatusCode != 500 || !fault.HasSubcode("NoProfile") {
+		t.Errorf("unexpected fault %+v", fault)
+	}
+}
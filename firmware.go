@@ -0,0 +1,357 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// firmwareDownTimeMargin is added to twice the ExpectedDownTime of a camera
+// to wait for it after a firmware upload
+const firmwareDownTimeMargin = time.Minute
+
+// DefaultFirmwareDownTime is the ExpectedDownTime assumed for a camera which
+// does not report one, such as a camera upgraded with UpgradeSystemFirmware
+const DefaultFirmwareDownTime = 2 * time.Minute
+
+// FirmwareUpgradeOptions tune StartFirmwareUpgrade
+type FirmwareUpgradeOptions struct {
+	// Version is the firmware version expected after the upgrade. When
+	// empty, the version only has to change.
+	Version string
+	// Progress is called as the image is sent with the bytes sent so far.
+	// With UpgradeSystemFirmware, the bytes of the whole MTOM request are
+	// counted. It never goes backwards: when the image is sent again, to
+	// answer an authentication challenge, Progress resumes once the new
+	// attempt passes the bytes already reported.
+	Progress func(sent, total int64)
+	// PollInterval is the interval between two polls waiting for the
+	// camera, DefaultReadyPollInterval when zero
+	PollInterval time.Duration
+}
+
+// FirmwareUpgrade is the outcome of StartFirmwareUpgrade
+type FirmwareUpgrade struct {
+	// Message is returned by the legacy UpgradeSystemFirmware, empty when
+	// the image was uploaded by HTTP POST
+	Message string
+	// PreviousVersion is the firmware version before the upgrade
+	PreviousVersion string
+	// Information is returned by GetInformation after the upgrade
+	Information DeviceInformation
+	// Outage is how long the camera was unavailable
+	Outage time.Duration
+}
+
+// StartFirmwareUpgrade upgrades the firmware of an ONVIF camera with the
+// image firmware and waits for the camera to be ready again. The image is
+// sent by HTTP POST to the URI returned by StartFirmwareUpgrade once its
+// UploadDelay elapsed, or with the legacy UpgradeSystemFirmware when the
+// camera does not support StartFirmwareUpgrade. The camera must be back
+// within twice its ExpectedDownTime, or DefaultFirmwareDownTime when it
+// reports none, plus a minute, and then report the expected FirmwareVersion
+// through GetInformation, or ErrFirmwareNotApplied is returned.
+// ErrRebootNotObserved is returned when the camera never stopped answering.
+// The upload is only limited by ctx, not by the client timeout.
+func (device *Device) StartFirmwareUpgrade(ctx context.Context, firmware []byte, options FirmwareUpgradeOptions) (FirmwareUpgrade, error) {
+	var upgrade FirmwareUpgrade
+
+	before, err := device.GetInformationWithContext(ctx)
+	if err != nil {
+		return upgrade, err
+	}
+	upgrade.PreviousVersion = before.FirmwareVersion
+
+	expectedDownTime, err := device.uploadFirmware(ctx, firmware, options.Progress)
+	if errors.Is(err, ErrActionNotSupported) {
+		log.Debugf("%s does not support StartFirmwareUpgrade, sending UpgradeSystemFirmware", device.XAddr)
+		upgrade.Message, err = device.upgradeSystemFirmware(ctx, firmware, options.Progress)
+	}
+	if err != nil {
+		return upgrade, err
+	}
+
+	if expectedDownTime <= 0 {
+		expectedDownTime = DefaultFirmwareDownTime
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 2*expectedDownTime+firmwareDownTimeMargin)
+	defer cancel()
+
+	upgrade.Outage, err = device.WaitForReboot(waitCtx, options.PollInterval)
+	if err != nil {
+		if ctx.Err() == nil && !errors.Is(err, ErrRebootNotObserved) {
+			return upgrade, fmt.Errorf("%s not ready after the firmware upgrade, expected down for %s: %w", device.XAddr, expectedDownTime, err)
+		}
+		return upgrade, err
+	}
+
+	upgrade.Information, err = device.GetInformationWithContext(ctx)
+	if err != nil {
+		return upgrade, err
+	}
+
+	version := upgrade.Information.FirmwareVersion
+	switch {
+	case options.Version != "" && version != options.Version:
+		return upgrade, fmt.Errorf("%w: firmware version is %s, expected %s", ErrFirmwareNotApplied, version, options.Version)
+	case options.Version == "" && version == upgrade.PreviousVersion:
+		return upgrade, fmt.Errorf("%w: firmware version is still %s", ErrFirmwareNotApplied, version)
+	}
+
+	return upgrade, nil
+}
+
+// UpgradeSystemFirmware sends a firmware image to an ONVIF camera in an MTOM
+// request, as older cameras expect, and returns the message of the camera.
+// The camera then reboots, StartFirmwareUpgrade also waits for it. With
+// AuthAuto, the authentication mode is negotiated with GetInformation first
+// so the image is not sent once per mode probed.
+func (device *Device) UpgradeSystemFirmware(firmware []byte) (string, error) {
+	return device.UpgradeSystemFirmwareWithContext(context.Background(), firmware)
+}
+
+// UpgradeSystemFirmwareWithContext is the context-aware variant of UpgradeSystemFirmware.
+func (device *Device) UpgradeSystemFirmwareWithContext(ctx context.Context, firmware []byte) (string, error) {
+	return device.upgradeSystemFirmware(ctx, firmware, nil)
+}
+
+// uploadFirmware requests an upload URI with StartFirmwareUpgrade, waits for
+// its UploadDelay and posts firmware to it. It returns the time the camera
+// expects to be down.
+func (device *Device) uploadFirmware(ctx context.Context, firmware []byte, progress func(sent, total int64)) (time.Duration, error) {
+	progress = monotonicProgress(progress)
+
+	// Create SOAP
+	soap := SOAP{
+		Request:  startFirmwareUpgrade{},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	var response startFirmwareUpgradeResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
+	if err != nil {
+		return 0, err
+	}
+	if response.UploadUri == "" {
+		return 0, errMissing("StartFirmwareUpgrade", "UploadUri")
+	}
+
+	uploadDelay, err := parseXSDuration(response.UploadDelay)
+	if err != nil {
+		return 0, fmt.Errorf("%w: UploadDelay: %v", ErrInvalidResponse, err)
+	}
+	expectedDownTime, err := parseXSDuration(response.ExpectedDownTime)
+	if err != nil {
+		return 0, fmt.Errorf("%w: ExpectedDownTime: %v", ErrInvalidResponse, err)
+	}
+
+	// The camera may need some time to get ready for the upload
+	timer := time.NewTimer(uploadDelay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-timer.C:
+	}
+
+	base, err := url.Parse(device.XAddr)
+	if err != nil {
+		return 0, err
+	}
+	uploadURI, err := base.Parse(response.UploadUri)
+	if err != nil {
+		return 0, err
+	}
+
+	// Ask for the go-ahead first, so an authentication challenge arrives
+	// before the image is sent
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Expect", "100-continue")
+
+	resp, _, err := device.state().auth.do(ctx, device.uploadClient(), "POST", uploadURI.String(), header, firmware, device.User, device.Password, progress)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return 0, fmt.Errorf("POST %s: %s: %w", uploadURI, resp.Status, ErrNotAuthorized)
+	case resp.StatusCode/100 != 2:
+		return 0, fmt.Errorf("POST %s: %s", uploadURI, resp.Status)
+	}
+
+	return expectedDownTime, nil
+}
+
+// upgradeSystemFirmware sends firmware with UpgradeSystemFirmware
+func (device *Device) upgradeSystemFirmware(ctx context.Context, firmware []byte, progress func(sent, total int64)) (string, error) {
+	progress = monotonicProgress(progress)
+
+	// Probing the authentication modes, or resynchronizing the clock,
+	// would send the image again, do it with a small request
+	if device.User != "" && device.EffectiveAuthMode() == AuthAuto {
+		if _, err := device.GetInformationWithContext(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	attachment := &soapAttachment{
+		contentID:   "firmware@onvif",
+		contentType: "application/octet-stream",
+		data:        firmware,
+	}
+
+	request := upgradeSystemFirmware{}
+	request.Firmware.ContentType = attachment.contentType
+	request.Firmware.Include.Href = "cid:" + attachment.contentID
+
+	// Create SOAP
+	soap := SOAP{
+		Request:    request,
+		User:       device.User,
+		Password:   device.Password,
+		Client:     device.uploadClient(),
+		attachment: attachment,
+		progress:   progress,
+	}
+
+	// Send SOAP request
+	var response upgradeSystemFirmwareResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
+	if err != nil {
+		return "", err
+	}
+
+	return response.Message, nil
+}
+
+// monotonicProgress wraps progress so that it only reports bytes beyond the
+// ones already reported, as a body sent again starts from zero
+func monotonicProgress(progress func(sent, total int64)) func(sent, total int64) {
+	if progress == nil {
+		return nil
+	}
+
+	var mutex sync.Mutex
+	var reported int64
+	return func(sent, total int64) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if sent > reported {
+			reported = sent
+			progress(sent, total)
+		}
+	}
+}
+
+// uploadClient returns the HTTP client of the device without its timeout,
+// which would cut the upload of a large image
+func (device *Device) uploadClient() *http.Client {
+	client := *device.Client.httpClient()
+	client.Timeout = 0
+	return &client
+}
+
+// soapAttachment is binary data sent along a SOAP request, which refers to
+// it with an xop:Include of its Content-ID
+type soapAttachment struct {
+	contentID   string
+	contentType string
+	data        []byte
+}
+
+// soapRootContentID is the Content-ID of the envelope in an MTOM package
+const soapRootContentID = "envelope@onvif"
+
+// pack returns the MTOM package of envelope and the attachment, and its
+// Content-Type
+func (attachment *soapAttachment) pack(envelope string) ([]byte, string, error) {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", `application/xop+xml; charset=UTF-8; type="application/soap+xml"`)
+	header.Set("Content-Transfer-Encoding", "8bit")
+	header.Set("Content-ID", "<"+soapRootContentID+">")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err = part.Write([]byte(envelope)); err != nil {
+		return nil, "", err
+	}
+
+	header = textproto.MIMEHeader{}
+	header.Set("Content-Type", attachment.contentType)
+	header.Set("Content-Transfer-Encoding", "binary")
+	header.Set("Content-ID", "<"+attachment.contentID+">")
+	part, err = writer.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err = part.Write(attachment.data); err != nil {
+		return nil, "", err
+	}
+
+	if err = writer.Close(); err != nil {
+		return nil, "", err
+	}
+
+	contentType := fmt.Sprintf(`multipart/related; type="application/xop+xml"; start="<%s>"; start-info="application/soap+xml"; boundary=%s`,
+		soapRootContentID, writer.Boundary())
+	return buffer.Bytes(), contentType, nil
+}
+
+var xsDurationPattern = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseXSDuration parses an xs:duration such as PT1M30S, counting years as
+// 365 days and months as 30 days. An empty value is a zero duration.
+func parseXSDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	match := xsDurationPattern.FindStringSubmatch(value)
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := []time.Duration{365 * 24 * time.Hour, 30 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute}
+	var duration time.Duration
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		duration += time.Duration(n) * unit
+	}
+	if match[6] != "" {
+		seconds, err := strconv.ParseFloat(match[6], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		duration += time.Duration(seconds * float64(time.Second))
+	}
+
+	return duration, nil
+}
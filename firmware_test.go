@@ -0,0 +1,218 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// firmwareServer is a camera running firmware 1.0 which is down for two
+// polls after receiving an image, and then runs firmware 2.0. A legacy
+// camera only supports UpgradeSystemFirmware. The upload URI requires Basic
+// authentication, and reads the image before challenging it. uploads counts
+// the images posted.
+func firmwareServer(t *testing.T, legacy bool, image *[]byte, uploads *int) *httptest.Server {
+	var mutex sync.Mutex
+	upgraded := false
+	polls := 0
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if r.URL.Path == "/upload" {
+			*uploads++
+			if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="upload"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.Header.Get("Content-Type") != "application/octet-stream" {
+				t.Errorf("unexpected upload Content-Type %s", r.Header.Get("Content-Type"))
+			}
+			*image = body
+			upgraded = true
+			return
+		}
+
+		var response string
+		switch {
+		case strings.Contains(string(body), "StartFirmwareUpgrade") && legacy:
+			w.WriteHeader(http.StatusBadRequest)
+			response = `<s:Fault><s:Code><s:Value>s:Receiver</s:Value><s:Subcode><s:Value>ter:ActionNotSupported</s:Value></s:Subcode></s:Code>
+<s:Reason><s:Text>Not supported</s:Text></s:Reason></s:Fault>`
+		case strings.Contains(string(body), "StartFirmwareUpgrade"):
+			response = `<StartFirmwareUpgradeResponse xmlns="http://www.onvif.org/ver10/device/wsdl">
+<UploadUri>` + server.URL + `/upload</UploadUri><UploadDelay>PT0.05S</UploadDelay><ExpectedDownTime>PT1S</ExpectedDownTime>
+</StartFirmwareUpgradeResponse>`
+		case strings.Contains(string(body), "UpgradeSystemFirmware"):
+			*image = mtomAttachment(t, r.Header.Get("Content-Type"), body)
+			upgraded = true
+			response = `<UpgradeSystemFirmwareResponse xmlns="http://www.onvif.org/ver10/device/wsdl">
+<Message>Upgrading</Message></UpgradeSystemFirmwareResponse>`
+		case strings.Contains(string(body), "GetSystemDateAndTime"):
+			if upgraded {
+				polls++
+				if polls == 1 || polls == 2 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+			}
+			now := time.Now().UTC()
+			response = fmt.Sprintf(`<GetSystemDateAndTimeResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><SystemDateAndTime>
+<DateTimeType>NTP</DateTimeType><UTCDateTime><Time><Hour>%d</Hour><Minute>%d</Minute><Second>%d</Second></Time>
+<Date><Year>%d</Year><Month>%d</Month><Day>%d</Day></Date></UTCDateTime>
+</SystemDateAndTime></GetSystemDateAndTimeResponse>`, now.Hour(), now.Minute(), now.Second(), now.Year(), now.Month(), now.Day())
+		case strings.Contains(string(body), "GetDeviceInformation"):
+			version := "1.0"
+			if upgraded && polls > 2 {
+				version = "2.0"
+			}
+			response = `<GetDeviceInformationResponse xmlns="http://www.onvif.org/ver10/device/wsdl">
+<Manufacturer>Acme</Manufacturer><Model>C1</Model><FirmwareVersion>` + version + `</FirmwareVersion></GetDeviceInformationResponse>`
+		default:
+			t.Errorf("unexpected request %s", body)
+		}
+		w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>` + response + `</s:Body></s:Envelope>`))
+	}))
+
+	return server
+}
+
+// mtomAttachment returns the part of an MTOM request referred to by its
+// xop:Include
+func mtomAttachment(t *testing.T, contentType string, body []byte) []byte {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/related" || params["type"] != "application/xop+xml" {
+		t.Errorf("unexpected MTOM Content-Type %s", contentType)
+		return nil
+	}
+
+	parts := make(map[string][]byte)
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := ioutil.ReadAll(part)
+		parts[part.Header.Get("Content-ID")] = data
+	}
+
+	envelope := string(parts[params["start"]])
+	start := strings.Index(envelope, `href="cid:`)
+	if start < 0 {
+		t.Errorf("envelope has no xop:Include: %s", envelope)
+		return nil
+	}
+	id := envelope[start+len(`href="cid:`):]
+	id = id[:strings.Index(id, `"`)]
+
+	return parts["<"+id+">"]
+}
+
+func TestStartFirmwareUpgrade(t *testing.T) {
+	firmware := bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, 64*1024)
+
+	for _, legacy := range []bool{false, true} {
+		var image []byte
+		var uploads int
+		server := firmwareServer(t, legacy, &image, &uploads)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var sent, total int64
+		backwards := false
+		options := FirmwareUpgradeOptions{
+			Version:      "2.0",
+			PollInterval: 20 * time.Millisecond,
+			Progress: func(s, t int64) {
+				backwards = backwards || s <= sent
+				sent, total = s, t
+			},
+		}
+
+		device := Device{XAddr: server.URL + "/onvif/device_service", User: "admin", Password: "secret"}
+		upgrade, err := device.StartFirmwareUpgrade(ctx, firmware, options)
+		cancel()
+		server.Close()
+
+		if err != nil {
+			t.Errorf("legacy %t: %v", legacy, err)
+			continue
+		}
+		if !bytes.Equal(image, firmware) {
+			t.Errorf("legacy %t: camera received %d bytes instead of the image", legacy, len(image))
+		}
+		// The MTOM request of a legacy camera is larger than the image
+		if total < int64(len(firmware)) || (!legacy && total != int64(len(firmware))) || sent != total {
+			t.Errorf("legacy %t: progress reported %d of %d bytes", legacy, sent, total)
+		}
+		// The image is posted again to answer the challenge
+		if !legacy && uploads != 2 {
+			t.Errorf("expected the image to be posted twice, got %d", uploads)
+		}
+		if backwards {
+			t.Errorf("legacy %t: progress went backwards", legacy)
+		}
+		if upgrade.PreviousVersion != "1.0" || upgrade.Information.FirmwareVersion != "2.0" || upgrade.Outage <= 0 {
+			t.Errorf("legacy %t: unexpected upgrade %+v", legacy, upgrade)
+		}
+		if legacy != (upgrade.Message == "Upgrading") {
+			t.Errorf("legacy %t: unexpected message %q", legacy, upgrade.Message)
+		}
+	}
+}
+
+func TestStartFirmwareUpgradeVersion(t *testing.T) {
+	var image []byte
+	var uploads int
+	server := firmwareServer(t, false, &image, &uploads)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	device := Device{XAddr: server.URL + "/onvif/device_service", User: "admin", Password: "secret"}
+	_, err := device.StartFirmwareUpgrade(ctx, []byte("image"), FirmwareUpgradeOptions{Version: "3.0", PollInterval: 20 * time.Millisecond})
+	if !errors.Is(err, ErrFirmwareNotApplied) {
+		t.Errorf("expected ErrFirmwareNotApplied, got %v", err)
+	}
+}
+
+func TestParseXSDuration(t *testing.T) {
+	valid := map[string]time.Duration{
+		"":                  0,
+		"PT30S":             30 * time.Second,
+		"PT1M30.5S":         90*time.Second + 500*time.Millisecond,
+		"P1DT2H":            26 * time.Hour,
+		"P0Y0M0DT0H2M0.0S":  2 * time.Minute,
+		" PT0.05S ":         50 * time.Millisecond,
+		"P1Y2M":             (365 + 60) * 24 * time.Hour,
+		"PT0H0M120S":        2 * time.Minute,
+		"P0Y0M0DT0H0M0.05S": 50 * time.Millisecond,
+	}
+	for value, expected := range valid {
+		duration, err := parseXSDuration(value)
+		if err != nil || duration != expected {
+			t.Errorf("%q: expected %v, got %v, %v", value, expected, duration, err)
+		}
+	}
+
+	for _, value := range []string{"P", "PT", "30S", "-PT5S", "PT5"} {
+		if _, err := parseXSDuration(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
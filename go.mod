@@ -7,9 +7,8 @@ require (
 	github.com/clbanning/mxj v1.8.2
 	github.com/gofrs/uuid v3.1.0+incompatible
 	github.com/kr/pretty v0.1.0 // indirect
-	github.com/pkg/errors v0.8.0
-	github.com/gofrs/uuid v1.2.0
+	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.4.2
-	golang.org/x/sync v0.0.0-20181221193216-37e7f081c4d4
+	golang.org/x/net v0.0.0-20200707034311-ab3426394381
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 )
@@ -2,14 +2,58 @@ package onvif
 
 // Device contains data of ONVIF camera
 type Device struct {
-	ID       string
-	Name     string
-	MACAddr  string
-	XAddr    string
-	User     string
-	Password string
-	IPAddress     string
-	Services map[string]Service
+	ID        string
+	Name      string
+	MACAddr   string
+	XAddr     string
+	User      string
+	Password  string
+	IPAddress string
+	Services  map[string]Service
+	// XAddrs are all the addresses announced by the device in WS-Discovery,
+	// XAddr is the one picked among them to reach it
+	XAddrs []string
+	// Types and Scopes are the WS-Discovery types and scopes of the device
+	Types  []string
+	Scopes []string
+	// ParsedScopes are the Scopes by category
+	ParsedScopes DeviceScopes
+	// MetadataVersion is incremented by the device when its Types, Scopes
+	// or XAddrs change
+	MetadataVersion uint32
+	// Client configures the HTTP client used for every request to the camera
+	Client ClientOptions
+	// AuthMode selects how User and Password are sent, AuthAuto by default
+	AuthMode AuthMode
+
+	connState *deviceState
+}
+
+// DiscoveryMode tells whether a camera answers WS-Discovery probes and
+// announces itself
+type DiscoveryMode string
+
+const (
+	// Discoverable cameras answer probes and send Hello and Bye messages
+	Discoverable DiscoveryMode = "Discoverable"
+	// NonDiscoverable cameras stay silent
+	NonDiscoverable DiscoveryMode = "NonDiscoverable"
+)
+
+// ScopeDefinition tells whether a scope can be changed
+type ScopeDefinition string
+
+const (
+	// ScopeFixed scopes are set by the camera and can not be removed
+	ScopeFixed ScopeDefinition = "Fixed"
+	// ScopeConfigurable scopes are set with SetScopes and AddScopes
+	ScopeConfigurable ScopeDefinition = "Configurable"
+)
+
+// Scope is a scope of ONVIF camera with its definition
+type Scope struct {
+	Definition ScopeDefinition
+	Item       string
 }
 
 // DeviceInformation contains information of ONVIF camera
@@ -198,7 +242,7 @@ type NetworkInterfaces struct {
 
 type IPv4 struct {
 	Enabled    string
-	IPv4Config IPv4Config `json:"Config"`
+	IPv4Config IPv4Config `json:"Config" xml:"Config"`
 }
 
 type IPv4Config struct {
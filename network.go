@@ -1,22 +1,11 @@
 package onvif
 
 import (
-	"encoding/json"
-	"fmt"
-	"strconv"
+	"context"
 
 	"github.com/pkg/errors"
 )
 
-type NetworkProtocolsResponse struct {
-	NetworkProtocols []networkProtocol `json:"NetworkProtocols"`
-}
-type networkProtocol struct {
-	Enabled string `json:"Enabled"`
-	Name    string `json:"Name"`
-	Port    string `json:"Port"`
-}
-
 type NetworkProtocol struct {
 	Enabled bool
 	Name    string
@@ -26,45 +15,35 @@ type NetworkProtocol struct {
 // GetNetworkProtocols fetches the network protocols that you can access the
 // device on.
 func (device Device) GetNetworkProtocols() ([]NetworkProtocol, error) {
+	return device.GetNetworkProtocolsWithContext(context.Background())
+}
+
+// GetNetworkProtocolsWithContext is the context-aware variant of GetNetworkProtocols.
+func (device Device) GetNetworkProtocolsWithContext(ctx context.Context) ([]NetworkProtocol, error) {
 	// Create SOAP
-	soap := &SOAP{
-		XMLNs: mediaXMLNs,
-		Body: `<trt:GetNetworkProtocols>
-		</trt:GetNetworkProtocols>`,
+	soap := SOAP{
+		Request:  getNetworkProtocols{},
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	var response getNetworkProtocolsResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
 	if err != nil {
 		return nil, errors.Wrap(err, "GetNetworkProtocols: Could not send SOAP request")
 	}
 
-	// Parse response to interface
-	npResp, err := response.ValueForPath("Envelope.Body.GetNetworkProtocolsResponse")
-	if err != nil {
-		return nil, errors.Wrap(err, "GetNetworkProtocols: Parse network protocols response")
-	}
-
-	m, err := json.MarshalIndent(npResp, "  ", "  ")
-
-	var npr NetworkProtocolsResponse
-	if err := json.Unmarshal(m, &npr); err != nil {
-		return nil, errors.Wrap(err, "GetNetworkProtocols: Could not unmarshal protocols response")
-	}
-
-	var nps = make([]NetworkProtocol, len(npr.NetworkProtocols))
-	for idx, np := range npr.NetworkProtocols {
-		port, err := strconv.ParseInt(np.Port, 10, 64)
-		if err != nil {
-			fmt.Println(err)
+	var nps = make([]NetworkProtocol, len(response.NetworkProtocols))
+	for idx, np := range response.NetworkProtocols {
+		if len(np.Port) == 0 {
+			return nil, errMissing("GetNetworkProtocols", "Port of "+np.Name)
 		}
 
 		nps[idx] = NetworkProtocol{
-			Enabled: np.Enabled == "true",
+			Enabled: np.Enabled,
 			Name:    np.Name,
-			Port:    port,
+			Port:    np.Port[0],
 		}
 	}
 
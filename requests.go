@@ -0,0 +1,372 @@
+package onvif
+
+import "encoding/xml"
+
+// Request bodies of the SOAP operations. They are marshalled with
+// encoding/xml, so every value sent to the device is escaped.
+//
+// Elements of the schema namespace (tt) set it on the outermost element,
+// nested elements inherit it.
+
+// Device service
+
+type getDeviceInformation struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetDeviceInformation"`
+}
+
+type getCapabilities struct {
+	XMLName  xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetCapabilities"`
+	Category string   `xml:"Category"`
+}
+
+type getDiscoveryMode struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetDiscoveryMode"`
+}
+
+type setDiscoveryMode struct {
+	XMLName       xml.Name      `xml:"http://www.onvif.org/ver10/device/wsdl SetDiscoveryMode"`
+	DiscoveryMode DiscoveryMode `xml:"DiscoveryMode"`
+}
+
+type getRemoteDiscoveryMode struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetRemoteDiscoveryMode"`
+}
+
+type setRemoteDiscoveryMode struct {
+	XMLName             xml.Name      `xml:"http://www.onvif.org/ver10/device/wsdl SetRemoteDiscoveryMode"`
+	RemoteDiscoveryMode DiscoveryMode `xml:"RemoteDiscoveryMode"`
+}
+
+type getDPAddresses struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetDPAddresses"`
+}
+
+type setDPAddresses struct {
+	XMLName   xml.Name             `xml:"http://www.onvif.org/ver10/device/wsdl SetDPAddresses"`
+	DPAddress []networkHostRequest `xml:"DPAddress"`
+}
+
+type getScopes struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetScopes"`
+}
+
+type setScopes struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl SetScopes"`
+	Scopes  []string `xml:"Scopes"`
+}
+
+type addScopes struct {
+	XMLName   xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl AddScopes"`
+	ScopeItem []string `xml:"ScopeItem"`
+}
+
+type removeScopes struct {
+	XMLName   xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl RemoveScopes"`
+	ScopeItem []string `xml:"ScopeItem"`
+}
+
+type getHostname struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetHostname"`
+}
+
+type setHostname struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl SetHostname"`
+	Name    string   `xml:"Name"`
+}
+
+type getNetworkInterfaces struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetNetworkInterfaces"`
+}
+
+type setNetworkInterfaces struct {
+	XMLName          xml.Name                `xml:"http://www.onvif.org/ver10/device/wsdl SetNetworkInterfaces"`
+	InterfaceToken   string                  `xml:"InterfaceToken"`
+	NetworkInterface networkInterfaceRequest `xml:"NetworkInterface"`
+}
+
+type networkInterfaceRequest struct {
+	Enabled bool `xml:"http://www.onvif.org/ver10/schema Enabled"`
+	MTU     int  `xml:"http://www.onvif.org/ver10/schema MTU,omitempty"`
+}
+
+type getNetworkProtocols struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetNetworkProtocols"`
+}
+
+type getServices struct {
+	XMLName           xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetServices"`
+	IncludeCapability bool     `xml:"IncludeCapability"`
+}
+
+type getNTP struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetNTP"`
+}
+
+type setNTP struct {
+	XMLName   xml.Name             `xml:"http://www.onvif.org/ver10/device/wsdl SetNTP"`
+	FromDHCP  bool                 `xml:"FromDHCP"`
+	NTPManual []networkHostRequest `xml:"NTPManual"`
+}
+
+type networkHostRequest struct {
+	Type        string `xml:"http://www.onvif.org/ver10/schema Type"`
+	IPv4Address string `xml:"http://www.onvif.org/ver10/schema IPv4Address,omitempty"`
+	IPv6Address string `xml:"http://www.onvif.org/ver10/schema IPv6Address,omitempty"`
+	DNSname     string `xml:"http://www.onvif.org/ver10/schema DNSname,omitempty"`
+}
+
+type systemReboot struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl SystemReboot"`
+}
+
+type setSystemFactoryDefault struct {
+	XMLName        xml.Name       `xml:"http://www.onvif.org/ver10/device/wsdl SetSystemFactoryDefault"`
+	FactoryDefault FactoryDefault `xml:"FactoryDefault"`
+}
+
+type startFirmwareUpgrade struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl StartFirmwareUpgrade"`
+}
+
+type upgradeSystemFirmware struct {
+	XMLName  xml.Name       `xml:"http://www.onvif.org/ver10/device/wsdl UpgradeSystemFirmware"`
+	Firmware attachmentData `xml:"Firmware"`
+}
+
+// attachmentData refers to an MTOM part by its Content-ID
+type attachmentData struct {
+	ContentType string `xml:"http://www.w3.org/2005/05/xmlmime contentType,attr,omitempty"`
+	Include     struct {
+		Href string `xml:"href,attr"`
+	} `xml:"http://www.w3.org/2004/08/xop/include Include"`
+}
+
+type getUsers struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetUsers"`
+}
+
+type createUsers struct {
+	XMLName xml.Name      `xml:"http://www.onvif.org/ver10/device/wsdl CreateUsers"`
+	User    []userRequest `xml:"User"`
+}
+
+type deleteUsers struct {
+	XMLName  xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl DeleteUsers"`
+	Username []string `xml:"Username"`
+}
+
+type setUser struct {
+	XMLName xml.Name      `xml:"http://www.onvif.org/ver10/device/wsdl SetUser"`
+	User    []userRequest `xml:"User"`
+}
+
+type userRequest struct {
+	Username  string `xml:"http://www.onvif.org/ver10/schema Username"`
+	Password  string `xml:"http://www.onvif.org/ver10/schema Password,omitempty"`
+	UserLevel string `xml:"http://www.onvif.org/ver10/schema UserLevel"`
+}
+
+type getSystemDateAndTime struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetSystemDateAndTime"`
+}
+
+type setSystemDateAndTime struct {
+	XMLName         xml.Name         `xml:"http://www.onvif.org/ver10/device/wsdl SetSystemDateAndTime"`
+	DateTimeType    string           `xml:"DateTimeType"`
+	DaylightSavings bool             `xml:"DaylightSavings"`
+	TimeZone        *timeZoneRequest `xml:"TimeZone,omitempty"`
+	UTCDateTime     *dateTimeRequest `xml:"UTCDateTime,omitempty"`
+}
+
+type timeZoneRequest struct {
+	TZ string `xml:"http://www.onvif.org/ver10/schema TZ"`
+}
+
+type dateTimeRequest struct {
+	Time timeRequest `xml:"http://www.onvif.org/ver10/schema Time"`
+	Date dateRequest `xml:"http://www.onvif.org/ver10/schema Date"`
+}
+
+type timeRequest struct {
+	Hour   int `xml:"Hour"`
+	Minute int `xml:"Minute"`
+	Second int `xml:"Second"`
+}
+
+type dateRequest struct {
+	Year  int `xml:"Year"`
+	Month int `xml:"Month"`
+	Day   int `xml:"Day"`
+}
+
+// Media service
+
+type getProfiles struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl GetProfiles"`
+}
+
+type getStreamURI struct {
+	XMLName      xml.Name           `xml:"http://www.onvif.org/ver10/media/wsdl GetStreamUri"`
+	StreamSetup  streamSetupRequest `xml:"StreamSetup"`
+	ProfileToken string             `xml:"ProfileToken"`
+}
+
+type streamSetupRequest struct {
+	Stream    string           `xml:"http://www.onvif.org/ver10/schema Stream"`
+	Transport transportRequest `xml:"http://www.onvif.org/ver10/schema Transport"`
+}
+
+type transportRequest struct {
+	Protocol string `xml:"Protocol"`
+}
+
+type getSnapshotURI struct {
+	XMLName      xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl GetSnapshotUri"`
+	ProfileToken string   `xml:"ProfileToken"`
+}
+
+type getOSDs struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl GetOSDs"`
+}
+
+type setOSD struct {
+	XMLName xml.Name   `xml:"http://www.onvif.org/ver10/media/wsdl SetOSD"`
+	OSD     osdRequest `xml:"OSD"`
+}
+
+type setOSD2 struct {
+	XMLName xml.Name   `xml:"http://www.onvif.org/ver20/media/wsdl SetOSD"`
+	OSD     osdRequest `xml:"OSD"`
+}
+
+type osdRequest struct {
+	Token                         string         `xml:"token,attr"`
+	VideoSourceConfigurationToken string         `xml:"http://www.onvif.org/ver10/schema VideoSourceConfigurationToken"`
+	Type                          string         `xml:"http://www.onvif.org/ver10/schema Type"`
+	Position                      osdPosRequest  `xml:"http://www.onvif.org/ver10/schema Position"`
+	TextString                    osdTextRequest `xml:"http://www.onvif.org/ver10/schema TextString"`
+}
+
+type osdPosRequest struct {
+	Type string        `xml:"Type"`
+	Pos  vectorRequest `xml:"Pos"`
+}
+
+type vectorRequest struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+type osdTextRequest struct {
+	Type      string           `xml:"Type"`
+	FontSize  int              `xml:"FontSize,omitempty"`
+	FontColor *osdColorRequest `xml:"FontColor,omitempty"`
+	PlainText string           `xml:"PlainText"`
+	Extension osdTextExtension `xml:"Extension"`
+}
+
+type osdColorRequest struct {
+	Color colorRequest `xml:"Color"`
+}
+
+type colorRequest struct {
+	X          float64 `xml:"X,attr"`
+	Y          float64 `xml:"Y,attr"`
+	Z          float64 `xml:"Z,attr"`
+	Colorspace string  `xml:"Colorspace,attr,omitempty"`
+}
+
+type osdTextExtension struct {
+	ChannelName bool `xml:"ChannelName"`
+}
+
+type setVideoEncoderConfiguration struct {
+	XMLName          xml.Name                  `xml:"http://www.onvif.org/ver10/media/wsdl SetVideoEncoderConfiguration"`
+	Configuration    videoEncoderConfigRequest `xml:"Configuration"`
+	ForcePersistence bool                      `xml:"ForcePersistence"`
+}
+
+type videoEncoderConfigRequest struct {
+	Token               string             `xml:"token,attr"`
+	GuaranteedFrameRate bool               `xml:"GuaranteedFrameRate,attr"`
+	Name                string             `xml:"http://www.onvif.org/ver10/schema Name"`
+	UseCount            int                `xml:"http://www.onvif.org/ver10/schema UseCount"`
+	Encoding            string             `xml:"http://www.onvif.org/ver10/schema Encoding"`
+	Resolution          resolutionRequest  `xml:"http://www.onvif.org/ver10/schema Resolution"`
+	Quality             int                `xml:"http://www.onvif.org/ver10/schema Quality"`
+	RateControl         rateControlRequest `xml:"http://www.onvif.org/ver10/schema RateControl"`
+	H264                h264Request        `xml:"http://www.onvif.org/ver10/schema H264"`
+	Multicast           multicastRequest   `xml:"http://www.onvif.org/ver10/schema Multicast"`
+	SessionTimeout      string             `xml:"http://www.onvif.org/ver10/schema SessionTimeout,omitempty"`
+}
+
+type resolutionRequest struct {
+	Width  int `xml:"Width"`
+	Height int `xml:"Height"`
+}
+
+type rateControlRequest struct {
+	ConstantBitRate  *bool `xml:"ConstantBitRate,attr,omitempty"`
+	FrameRateLimit   int   `xml:"FrameRateLimit"`
+	EncodingInterval int   `xml:"EncodingInterval,omitempty"`
+	BitrateLimit     int   `xml:"BitrateLimit"`
+}
+
+type h264Request struct {
+	GovLength   int    `xml:"GovLength"`
+	H264Profile string `xml:"H264Profile"`
+}
+
+type multicastRequest struct {
+	Address   multicastAddressRequest `xml:"Address"`
+	Port      int                     `xml:"Port"`
+	TTL       int                     `xml:"TTL"`
+	AutoStart bool                    `xml:"AutoStart"`
+}
+
+type multicastAddressRequest struct {
+	Type        string `xml:"Type"`
+	IPv4Address string `xml:"IPv4Address"`
+}
+
+// Media2 service
+
+type setVideoEncoderConfiguration2 struct {
+	XMLName       xml.Name                   `xml:"http://www.onvif.org/ver20/media/wsdl SetVideoEncoderConfiguration"`
+	Configuration videoEncoderConfig2Request `xml:"Configuration"`
+}
+
+type videoEncoderConfig2Request struct {
+	Token       string             `xml:"token,attr"`
+	GovLength   int                `xml:"GovLength,attr"`
+	Profile     string             `xml:"Profile,attr"`
+	Name        string             `xml:"http://www.onvif.org/ver10/schema Name"`
+	UseCount    int                `xml:"http://www.onvif.org/ver10/schema UseCount"`
+	Encoding    string             `xml:"http://www.onvif.org/ver10/schema Encoding"`
+	Resolution  resolutionRequest  `xml:"http://www.onvif.org/ver10/schema Resolution"`
+	RateControl rateControlRequest `xml:"http://www.onvif.org/ver10/schema RateControl"`
+	Multicast   multicastRequest   `xml:"http://www.onvif.org/ver10/schema Multicast"`
+	Quality     int                `xml:"http://www.onvif.org/ver10/schema Quality"`
+}
+
+type setAudioEncoderConfiguration2 struct {
+	XMLName       xml.Name                   `xml:"http://www.onvif.org/ver20/media/wsdl SetAudioEncoderConfiguration"`
+	Configuration audioEncoderConfig2Request `xml:"Configuration"`
+}
+
+type audioEncoderConfig2Request struct {
+	Token      string           `xml:"token,attr"`
+	Name       string           `xml:"http://www.onvif.org/ver10/schema Name"`
+	UseCount   int              `xml:"http://www.onvif.org/ver10/schema UseCount"`
+	Encoding   string           `xml:"http://www.onvif.org/ver10/schema Encoding"`
+	Multicast  multicastRequest `xml:"http://www.onvif.org/ver10/schema Multicast"`
+	Bitrate    int              `xml:"http://www.onvif.org/ver10/schema Bitrate"`
+	SampleRate int              `xml:"http://www.onvif.org/ver10/schema SampleRate"`
+}
+
+// Imaging service
+
+type getImagingSettings struct {
+	XMLName          xml.Name `xml:"http://www.onvif.org/ver20/imaging/wsdl GetImagingSettings"`
+	VideoSourceToken string   `xml:"VideoSourceToken"`
+}
@@ -0,0 +1,110 @@
+package onvif
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestEscaping(t *testing.T) {
+	text := `Gate <1> & "Lobby"  </tt:PlainText>`
+	soap := SOAP{
+		Request: setOSD{
+			OSD: osdRequest{
+				Token:      "OSD_1",
+				Type:       "Text",
+				TextString: osdTextRequest{Type: "Plain", PlainText: text},
+			},
+		},
+		User:     "admin&<co>",
+		Password: "secret",
+		AuthMode: AuthWSSecurityText,
+	}
+
+	request, err := soap.createRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var envelope struct {
+		Header struct {
+			Security struct {
+				UsernameToken struct {
+					Username string `xml:"Username"`
+				} `xml:"UsernameToken"`
+			} `xml:"Security"`
+		} `xml:"Header"`
+		Body struct {
+			SetOSD struct {
+				XMLName xml.Name
+				OSD     struct {
+					TextString struct {
+						XMLName   xml.Name
+						PlainText string `xml:"PlainText"`
+					} `xml:"TextString"`
+				} `xml:"OSD"`
+			} `xml:"SetOSD"`
+		} `xml:"Body"`
+	}
+	if err = xml.Unmarshal([]byte(request), &envelope); err != nil {
+		t.Fatalf("request is not well-formed: %v\n%s", err, request)
+	}
+
+	if got := envelope.Body.SetOSD.OSD.TextString.PlainText; got != text {
+		t.Errorf("OSD text was altered: %q", got)
+	}
+	if got := envelope.Header.Security.UsernameToken.Username; got != "admin&<co>" {
+		t.Errorf("username was altered: %q", got)
+	}
+	if ns := envelope.Body.SetOSD.XMLName.Space; ns != mediaNameSpace {
+		t.Errorf("unexpected SetOSD namespace %q", ns)
+	}
+	if ns := envelope.Body.SetOSD.OSD.TextString.XMLName.Space; ns != "http://www.onvif.org/ver10/schema" {
+		t.Errorf("unexpected TextString namespace %q", ns)
+	}
+	if strings.Contains(request, "<1>") {
+		t.Errorf("OSD text was not escaped: %s", request)
+	}
+}
+
+func TestRequestDPAddresses(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<SetDPAddressesResponse xmlns="http://www.onvif.org/ver10/device/wsdl"/></s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	device := Device{XAddr: server.URL}
+	err := device.SetDPAddresses([]NetworkHost{
+		{Type: "IPv4", IPv4Address: "192.0.2.10"},
+		{Type: "DNS", DNSname: "proxy.example"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var request struct {
+		DPAddress []struct {
+			XMLName     xml.Name
+			Type        string `xml:"http://www.onvif.org/ver10/schema Type"`
+			IPv4Address string `xml:"http://www.onvif.org/ver10/schema IPv4Address"`
+			DNSname     string `xml:"http://www.onvif.org/ver10/schema DNSname"`
+		} `xml:"Body>SetDPAddresses>DPAddress"`
+	}
+	if err = xml.Unmarshal(body, &request); err != nil {
+		t.Fatal(err)
+	}
+
+	addresses := request.DPAddress
+	if len(addresses) != 2 || addresses[0].IPv4Address != "192.0.2.10" || addresses[1].Type != "DNS" || addresses[1].DNSname != "proxy.example" {
+		t.Errorf("unexpected DPAddress %+v", addresses)
+	}
+	if len(addresses) > 0 && addresses[0].XMLName.Space != "http://www.onvif.org/ver10/device/wsdl" {
+		t.Errorf("unexpected DPAddress namespace %q", addresses[0].XMLName.Space)
+	}
+}
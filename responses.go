@@ -0,0 +1,358 @@
+package onvif
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Response bodies of the SOAP operations, decoded with encoding/xml.
+//
+// The response element is matched with its namespace, so an answer to
+// another operation or service is rejected. Its children are matched on
+// their local name only.
+
+// decodeResponse decodes the first element of the SOAP body into response
+func decodeResponse(body []byte, response interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+
+	inBody := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return fmt.Errorf("%w: no SOAP body", ErrInvalidResponse)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if !inBody {
+				inBody = token.Name.Local == "Body"
+				continue
+			}
+
+			if err = decoder.DecodeElement(response, &token); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+			}
+			return nil
+		case xml.EndElement:
+			if inBody {
+				return fmt.Errorf("%w: empty SOAP body", ErrInvalidResponse)
+			}
+		}
+	}
+}
+
+// errMissing reports a required element absent from a response
+func errMissing(operation, element string) error {
+	return fmt.Errorf("%w: %s has no %s", ErrInvalidResponse, operation, element)
+}
+
+// Device service
+
+type getDeviceInformationResponse struct {
+	XMLName         xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetDeviceInformationResponse"`
+	Manufacturer    string   `xml:"Manufacturer"`
+	Model           string   `xml:"Model"`
+	FirmwareVersion string   `xml:"FirmwareVersion"`
+	SerialNumber    string   `xml:"SerialNumber"`
+	HardwareID      string   `xml:"HardwareId"`
+}
+
+type getCapabilitiesResponse struct {
+	XMLName      xml.Name             `xml:"http://www.onvif.org/ver10/device/wsdl GetCapabilitiesResponse"`
+	Capabilities capabilitiesResponse `xml:"Capabilities"`
+}
+
+type capabilitiesResponse struct {
+	Analytics *xaddrResponse              `xml:"Analytics"`
+	Device    *deviceCapabilitiesResponse `xml:"Device"`
+	Events    *eventsCapabilitiesResponse `xml:"Events"`
+	Imaging   *xaddrResponse              `xml:"Imaging"`
+	Media     *mediaCapabilitiesResponse  `xml:"Media"`
+	PTZ       *xaddrResponse              `xml:"PTZ"`
+}
+
+type xaddrResponse struct {
+	XAddr string `xml:"XAddr"`
+}
+
+type deviceCapabilitiesResponse struct {
+	xaddrResponse
+	Network *struct {
+		IPFilter          bool `xml:"IPFilter"`
+		ZeroConfiguration bool `xml:"ZeroConfiguration"`
+		IPVersion6        bool `xml:"IPVersion6"`
+		DynDNS            bool `xml:"DynDNS"`
+	} `xml:"Network"`
+}
+
+type eventsCapabilitiesResponse struct {
+	xaddrResponse
+	Flags []capabilityFlag `xml:",any"`
+}
+
+type mediaCapabilitiesResponse struct {
+	xaddrResponse
+	StreamingCapabilities *struct {
+		Flags []capabilityFlag `xml:",any"`
+	} `xml:"StreamingCapabilities"`
+}
+
+// capabilityFlag is a boolean capability identified by its element name
+type capabilityFlag struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// xaddrs returns the XAddr of each category present, keyed by category name
+func (capabilities capabilitiesResponse) xaddrs() map[string]string {
+	xaddrs := make(map[string]string)
+	add := func(category string, xaddr *xaddrResponse) {
+		if xaddr != nil {
+			xaddrs[category] = xaddr.XAddr
+		}
+	}
+
+	add("Analytics", capabilities.Analytics)
+	add("Imaging", capabilities.Imaging)
+	add("PTZ", capabilities.PTZ)
+	if capabilities.Device != nil {
+		add("Device", &capabilities.Device.xaddrResponse)
+	}
+	if capabilities.Events != nil {
+		add("Events", &capabilities.Events.xaddrResponse)
+	}
+	if capabilities.Media != nil {
+		add("Media", &capabilities.Media.xaddrResponse)
+	}
+
+	return xaddrs
+}
+
+type getDiscoveryModeResponse struct {
+	XMLName       xml.Name      `xml:"http://www.onvif.org/ver10/device/wsdl GetDiscoveryModeResponse"`
+	DiscoveryMode DiscoveryMode `xml:"DiscoveryMode"`
+}
+
+type getRemoteDiscoveryModeResponse struct {
+	XMLName             xml.Name      `xml:"http://www.onvif.org/ver10/device/wsdl GetRemoteDiscoveryModeResponse"`
+	RemoteDiscoveryMode DiscoveryMode `xml:"RemoteDiscoveryMode"`
+}
+
+type getDPAddressesResponse struct {
+	XMLName   xml.Name      `xml:"http://www.onvif.org/ver10/device/wsdl GetDPAddressesResponse"`
+	DPAddress []NetworkHost `xml:"DPAddress"`
+}
+
+type getScopesResponse struct {
+	XMLName xml.Name        `xml:"http://www.onvif.org/ver10/device/wsdl GetScopesResponse"`
+	Scopes  []scopeResponse `xml:"Scopes"`
+}
+
+type scopeResponse struct {
+	ScopeDef  string `xml:"ScopeDef"`
+	ScopeItem string `xml:"ScopeItem"`
+}
+
+type removeScopesResponse struct {
+	XMLName   xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl RemoveScopesResponse"`
+	ScopeItem []string `xml:"ScopeItem"`
+}
+
+type getHostnameResponse struct {
+	XMLName             xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetHostnameResponse"`
+	HostnameInformation *struct {
+		FromDHCP bool   `xml:"FromDHCP"`
+		Name     string `xml:"Name"`
+	} `xml:"HostnameInformation"`
+}
+
+type getNetworkInterfacesResponse struct {
+	XMLName           xml.Name            `xml:"http://www.onvif.org/ver10/device/wsdl GetNetworkInterfacesResponse"`
+	NetworkInterfaces []NetworkInterfaces `xml:"NetworkInterfaces"`
+}
+
+type getNetworkProtocolsResponse struct {
+	XMLName          xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetNetworkProtocolsResponse"`
+	NetworkProtocols []struct {
+		Name    string  `xml:"Name"`
+		Enabled bool    `xml:"Enabled"`
+		Port    []int64 `xml:"Port"`
+	} `xml:"NetworkProtocols"`
+}
+
+type systemRebootResponse struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl SystemRebootResponse"`
+	Message string   `xml:"Message"`
+}
+
+type startFirmwareUpgradeResponse struct {
+	XMLName          xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl StartFirmwareUpgradeResponse"`
+	UploadUri        string   `xml:"UploadUri"`
+	UploadDelay      string   `xml:"UploadDelay"`
+	ExpectedDownTime string   `xml:"ExpectedDownTime"`
+}
+
+type upgradeSystemFirmwareResponse struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl UpgradeSystemFirmwareResponse"`
+	Message string   `xml:"Message"`
+}
+
+type getUsersResponse struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetUsersResponse"`
+	User    []struct {
+		Username  string `xml:"Username"`
+		UserLevel string `xml:"UserLevel"`
+	} `xml:"User"`
+}
+
+type getServicesResponse struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetServicesResponse"`
+	Service []struct {
+		Namespace string  `xml:"Namespace"`
+		XAddr     string  `xml:"XAddr"`
+		Version   Version `xml:"Version"`
+	} `xml:"Service"`
+}
+
+type getSystemDateAndTimeResponse struct {
+	XMLName           xml.Name           `xml:"http://www.onvif.org/ver10/device/wsdl GetSystemDateAndTimeResponse"`
+	SystemDateAndTime *SystemDateAndTime `xml:"SystemDateAndTime"`
+}
+
+type getNTPResponse struct {
+	XMLName        xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetNTPResponse"`
+	NTPInformation *struct {
+		FromDHCP    bool          `xml:"FromDHCP"`
+		NTPFromDHCP []NetworkHost `xml:"NTPFromDHCP"`
+		NTPManual   []NetworkHost `xml:"NTPManual"`
+	} `xml:"NTPInformation"`
+}
+
+// Media service
+
+type getProfilesResponse struct {
+	XMLName  xml.Name          `xml:"http://www.onvif.org/ver10/media/wsdl GetProfilesResponse"`
+	Profiles []profileResponse `xml:"Profiles"`
+}
+
+type profileResponse struct {
+	Token                     string `xml:"token,attr"`
+	Name                      string `xml:"Name"`
+	VideoSourceConfiguration  *sourceConfigResponse
+	AudioSourceConfiguration  *sourceConfigResponse
+	VideoEncoderConfiguration *struct {
+		Token          string  `xml:"token,attr"`
+		Name           string  `xml:"Name"`
+		Encoding       string  `xml:"Encoding"`
+		Quality        float64 `xml:"Quality"`
+		SessionTimeout string  `xml:"SessionTimeout"`
+		Resolution     struct {
+			Width  int `xml:"Width"`
+			Height int `xml:"Height"`
+		} `xml:"Resolution"`
+		RateControl struct {
+			FrameRateLimit   int `xml:"FrameRateLimit"`
+			EncodingInterval int `xml:"EncodingInterval"`
+			BitrateLimit     int `xml:"BitrateLimit"`
+		} `xml:"RateControl"`
+		H264 struct {
+			GovLength int `xml:"GovLength"`
+		} `xml:"H264"`
+	}
+	AudioEncoderConfiguration *struct {
+		Token          string `xml:"token,attr"`
+		Name           string `xml:"Name"`
+		Encoding       string `xml:"Encoding"`
+		Bitrate        int    `xml:"Bitrate"`
+		SampleRate     int    `xml:"SampleRate"`
+		SessionTimeout string `xml:"SessionTimeout"`
+	}
+	PTZConfiguration *struct {
+		Token     string `xml:"token,attr"`
+		Name      string `xml:"Name"`
+		NodeToken string `xml:"NodeToken"`
+	}
+}
+
+type sourceConfigResponse struct {
+	Token       string `xml:"token,attr"`
+	Name        string `xml:"Name"`
+	SourceToken string `xml:"SourceToken"`
+	Bounds      struct {
+		Width  int `xml:"width,attr"`
+		Height int `xml:"height,attr"`
+	} `xml:"Bounds"`
+}
+
+type getStreamURIResponse struct {
+	XMLName  xml.Name          `xml:"http://www.onvif.org/ver10/media/wsdl GetStreamUriResponse"`
+	MediaURI *mediaURIResponse `xml:"MediaUri"`
+}
+
+type getSnapshotURIResponse struct {
+	XMLName  xml.Name          `xml:"http://www.onvif.org/ver10/media/wsdl GetSnapshotUriResponse"`
+	MediaURI *mediaURIResponse `xml:"MediaUri"`
+}
+
+type mediaURIResponse struct {
+	URI                 string `xml:"Uri"`
+	InvalidAfterConnect bool   `xml:"InvalidAfterConnect"`
+	InvalidAfterReboot  bool   `xml:"InvalidAfterReboot"`
+	Timeout             string `xml:"Timeout"`
+}
+
+// mediaURI converts a MediaUri element, which must hold an URI
+func (uri *mediaURIResponse) mediaURI(operation string) (MediaURI, error) {
+	if uri == nil || uri.URI == "" {
+		return MediaURI{}, errMissing(operation, "MediaUri")
+	}
+
+	return MediaURI{
+		URI:                 uri.URI,
+		Timeout:             uri.Timeout,
+		InvalidAfterConnect: uri.InvalidAfterConnect,
+		InvalidAfterReboot:  uri.InvalidAfterReboot,
+	}, nil
+}
+
+type getOSDsResponse struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl GetOSDsResponse"`
+	OSDs    []struct {
+		Token                         string `xml:"token,attr"`
+		VideoSourceConfigurationToken string `xml:"VideoSourceConfigurationToken"`
+		Type                          string `xml:"Type"`
+		Position                      struct {
+			Type string `xml:"Type"`
+			Pos  struct {
+				X float64 `xml:"x,attr"`
+				Y float64 `xml:"y,attr"`
+			} `xml:"Pos"`
+		} `xml:"Position"`
+		TextString struct {
+			IsPersistentText bool             `xml:"IsPersistentText"`
+			Type             string           `xml:"Type"`
+			DateFormat       string           `xml:"DateFormat"`
+			TimeFormat       string           `xml:"TimeFormat"`
+			FontSize         int              `xml:"FontSize"`
+			FontColor        osdColorResponse `xml:"FontColor"`
+			BackgroundColor  osdColorResponse `xml:"BackgroundColor"`
+			PlainText        string           `xml:"PlainText"`
+		} `xml:"TextString"`
+	} `xml:"OSDs"`
+}
+
+type osdColorResponse struct {
+	Transparent int `xml:"Transparent,attr"`
+}
+
+// Imaging service
+
+type getImagingSettingsResponse struct {
+	XMLName         xml.Name         `xml:"http://www.onvif.org/ver20/imaging/wsdl GetImagingSettingsResponse"`
+	ImagingSettings *ImagingSettings `xml:"ImagingSettings"`
+}
@@ -0,0 +1,58 @@
+package onvif
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	envelope := func(body string) []byte {
+		return []byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"
+xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:timg="http://www.onvif.org/ver20/imaging/wsdl"
+xmlns:tt="http://www.onvif.org/ver10/schema"><s:Header/><s:Body>` + body + `</s:Body></s:Envelope>`)
+	}
+
+	var settings getImagingSettingsResponse
+	err := decodeResponse(envelope(`<timg:GetImagingSettingsResponse><timg:ImagingSettings>
+<tt:Brightness>50.5</tt:Brightness>
+<tt:Exposure><tt:Mode>AUTO</tt:Mode><tt:MaxGain>12</tt:MaxGain></tt:Exposure>
+<tt:IrCutFilter>AUTO</tt:IrCutFilter>
+</timg:ImagingSettings></timg:GetImagingSettingsResponse>`), &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := settings.ImagingSettings; s == nil || s.Brightness != 50.5 || s.Exposure.Mode != "AUTO" || s.Exposure.MaxGain != 12 || s.IrCutFilter != "AUTO" {
+		t.Errorf("unexpected imaging settings %+v", settings.ImagingSettings)
+	}
+
+	invalid := map[string]string{
+		"malformed number": `<tds:GetSystemDateAndTimeResponse><tds:SystemDateAndTime><tt:UTCDateTime>
+<tt:Time><tt:Hour>noon</tt:Hour></tt:Time></tt:UTCDateTime></tds:SystemDateAndTime></tds:GetSystemDateAndTimeResponse>`,
+		"other operation": `<tds:GetHostnameResponse/>`,
+		"other namespace": `<timg:GetSystemDateAndTimeResponse/>`,
+		"empty body":      ``,
+	}
+	for name, body := range invalid {
+		var response getSystemDateAndTimeResponse
+		if err := decodeResponse(envelope(body), &response); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("%s: expected ErrInvalidResponse, got %v", name, err)
+		}
+	}
+}
+
+func TestGetServicesMissingXAddr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetServicesResponse xmlns="http://www.onvif.org/ver10/device/wsdl">
+<Service><Namespace>http://www.onvif.org/ver10/media/wsdl</Namespace></Service>
+</GetServicesResponse></s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	device := Device{XAddr: server.URL}
+	if _, err := device.GetServices(); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse, got %v", err)
+	}
+}
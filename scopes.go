@@ -0,0 +1,108 @@
+package onvif
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DeviceScopes are the ONVIF scopes of a device by category. Values are
+// URL-decoded.
+type DeviceScopes struct {
+	Names     []string
+	Locations []string
+	Hardware  []string
+	// Profiles are the ONVIF profiles the device conforms to, S for the
+	// Streaming profile, then G, T, M, C...
+	Profiles []string
+	Types    []string
+	// Countries are taken from country and location/country scopes
+	Countries []string
+	MACs      []string
+	// Other are the vendor and unknown scopes, left as they are
+	Other []string
+}
+
+// ParseScopes sorts scopes by category
+func ParseScopes(scopes []string) DeviceScopes {
+	var parsed DeviceScopes
+	for _, scope := range scopes {
+		parsed.add(scope)
+	}
+	return parsed
+}
+
+// HasProfile tells whether the device conforms to an ONVIF profile, like
+// "S" or "T"
+func (scopes DeviceScopes) HasProfile(profile string) bool {
+	for _, p := range scopes.Profiles {
+		if strings.EqualFold(p, profile) {
+			return true
+		}
+	}
+	return false
+}
+
+// add sorts a single scope
+func (scopes *DeviceScopes) add(scope string) {
+	scope = strings.TrimSpace(scope)
+	if !hasPrefixFold(scope, onvifScopePrefix) {
+		scopes.Other = append(scopes.Other, scope)
+		return
+	}
+
+	parts := strings.SplitN(scope[len(onvifScopePrefix):], "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		scopes.Other = append(scopes.Other, scope)
+		return
+	}
+
+	value, err := url.PathUnescape(parts[1])
+	if err != nil {
+		value = parts[1]
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "name":
+		scopes.Names = append(scopes.Names, value)
+	case "location":
+		scopes.Locations = append(scopes.Locations, value)
+		if country := strings.TrimPrefix(value, "country/"); country != value {
+			scopes.Countries = append(scopes.Countries, country)
+		}
+	case "hardware":
+		scopes.Hardware = append(scopes.Hardware, value)
+	case "profile":
+		if strings.EqualFold(value, "Streaming") {
+			value = "S"
+		}
+		scopes.Profiles = append(scopes.Profiles, value)
+	case "type":
+		scopes.Types = append(scopes.Types, value)
+	case "country":
+		scopes.Countries = append(scopes.Countries, value)
+	case "mac":
+		scopes.MACs = append(scopes.MACs, value)
+	default:
+		scopes.Other = append(scopes.Other, scope)
+	}
+}
+
+// hasPrefixFold tells whether s begins with prefix, ignoring case
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// setScopes updates the scopes of the device and the fields derived from
+// them
+func (device *Device) setScopes(scopes []string) {
+	device.Scopes = scopes
+	device.ParsedScopes = ParseScopes(scopes)
+
+	// Some devices write spaces of their name as underscores
+	if names := device.ParsedScopes.Names; len(names) > 0 {
+		device.Name = strings.Replace(names[len(names)-1], "_", " ", -1)
+	}
+	if macs := device.ParsedScopes.MACs; len(macs) > 0 {
+		device.MACAddr = macs[len(macs)-1]
+	}
+}
@@ -0,0 +1,155 @@
+package onvif
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	scopes := ParseScopes([]string{
+		"onvif://www.onvif.org/name/Lobby%20Camera",
+		"onvif://www.onvif.org/location/country/France",
+		"onvif://www.onvif.org/location/building-7",
+		"onvif://www.onvif.org/hardware/P1435-LE",
+		"onvif://www.onvif.org/Profile/Streaming",
+		"onvif://www.onvif.org/Profile/T",
+		"onvif://www.onvif.org/type/video_encoder",
+		"onvif://www.onvif.org/country/fr",
+		"onvif://www.onvif.org/MAC/00:40:8c:12:34:56",
+		"onvif://www.onvif.org/extension/unique_identifier",
+		"http://www.axis.com/vendor/scope",
+		"onvif://www.onvif.org/name/",
+	})
+
+	expected := DeviceScopes{
+		Names:     []string{"Lobby Camera"},
+		Locations: []string{"country/France", "building-7"},
+		Hardware:  []string{"P1435-LE"},
+		Profiles:  []string{"S", "T"},
+		Types:     []string{"video_encoder"},
+		Countries: []string{"France", "fr"},
+		MACs:      []string{"00:40:8c:12:34:56"},
+		Other: []string{
+			"onvif://www.onvif.org/extension/unique_identifier",
+			"http://www.axis.com/vendor/scope",
+			"onvif://www.onvif.org/name/",
+		},
+	}
+	if !reflect.DeepEqual(scopes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, scopes)
+	}
+	if !scopes.HasProfile("s") || scopes.HasProfile("G") {
+		t.Errorf("unexpected profiles %v", scopes.Profiles)
+	}
+}
+
+func TestGetScopesParsed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetScopesResponse xmlns="http://www.onvif.org/ver10/device/wsdl">
+<Scopes><ScopeDef>Fixed</ScopeDef><ScopeItem>onvif://www.onvif.org/Profile/G</ScopeItem></Scopes>
+<Scopes><ScopeDef>Configurable</ScopeDef><ScopeItem>onvif://www.onvif.org/name/Gate_2</ScopeItem></Scopes>
+</GetScopesResponse></s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	device := Device{XAddr: server.URL}
+	scopes, err := device.GetScopes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scopes) != 2 || !reflect.DeepEqual(device.Scopes, scopes) {
+		t.Errorf("unexpected scopes %v, device scopes %v", scopes, device.Scopes)
+	}
+	if !device.ParsedScopes.HasProfile("G") || device.Name != "Gate 2" {
+		t.Errorf("unexpected parsed scopes %+v, name %q", device.ParsedScopes, device.Name)
+	}
+}
+
+// scopesServer answers GetScopes with a fixed and configurable scopes, and
+// records the scopes sent by SetScopes
+func scopesServer(t *testing.T, set *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var response string
+		switch {
+		case strings.Contains(string(body), "GetScopes"):
+			response = `<GetScopesResponse xmlns="http://www.onvif.org/ver10/device/wsdl">
+<Scopes><ScopeDef>Fixed</ScopeDef><ScopeItem>onvif://www.onvif.org/hardware/P1435</ScopeItem></Scopes>
+<Scopes><ScopeDef>Configurable</ScopeDef><ScopeItem>onvif://www.onvif.org/name/Old</ScopeItem></Scopes>
+<Scopes><ScopeDef>Configurable</ScopeDef><ScopeItem>onvif://www.onvif.org/location/city/Lyon</ScopeItem></Scopes>
+<Scopes><ScopeDef>Configurable</ScopeDef><ScopeItem>onvif://www.onvif.org/location/building-7</ScopeItem></Scopes>
+<Scopes><ScopeDef>Configurable</ScopeDef><ScopeItem>http://vendor.example/zone/3</ScopeItem></Scopes>
+</GetScopesResponse>`
+		case strings.Contains(string(body), "SetScopes"):
+			var request struct {
+				Scopes []string `xml:"Body>SetScopes>Scopes"`
+			}
+			if err := xml.Unmarshal(body, &request); err != nil {
+				t.Error(err)
+			}
+			*set = request.Scopes
+			response = `<SetScopesResponse xmlns="http://www.onvif.org/ver10/device/wsdl"/>`
+		case strings.Contains(string(body), "RemoveScopes"):
+			response = `<RemoveScopesResponse xmlns="http://www.onvif.org/ver10/device/wsdl">
+<ScopeItem>http://vendor.example/zone/3</ScopeItem></RemoveScopesResponse>`
+		}
+
+		w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>` + response + `</s:Body></s:Envelope>`))
+	}))
+}
+
+func TestSetDeviceName(t *testing.T) {
+	var set []string
+	server := scopesServer(t, &set)
+	defer server.Close()
+
+	device := Device{XAddr: server.URL}
+	if err := device.SetDeviceName("Lobby Camera", "Paris"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"onvif://www.onvif.org/location/building-7",
+		"http://vendor.example/zone/3",
+		"onvif://www.onvif.org/name/Lobby%20Camera",
+		"onvif://www.onvif.org/location/city/Paris",
+	}
+	if !reflect.DeepEqual(set, expected) {
+		t.Errorf("expected %v, got %v", expected, set)
+	}
+
+	// An empty location keeps the current one
+	if err := device.SetDeviceName("Gate", ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 4 || set[1] != "onvif://www.onvif.org/location/building-7" || set[3] != "onvif://www.onvif.org/name/Gate" {
+		t.Errorf("unexpected scopes %v", set)
+	}
+}
+
+func TestRemoveScopes(t *testing.T) {
+	server := scopesServer(t, new([]string))
+	defer server.Close()
+
+	device := Device{XAddr: server.URL}
+	removed, err := device.RemoveScopes([]string{"http://vendor.example/zone/3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{"http://vendor.example/zone/3"}) {
+		t.Errorf("unexpected removed scopes %v", removed)
+	}
+
+	_, err = device.RemoveScopes([]string{"onvif://www.onvif.org/hardware/P1435"})
+	if !errors.Is(err, ErrFixedScope) {
+		t.Errorf("expected ErrFixedScope, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Namespaces of the ONVIF services, used as keys of Device.Services
+const (
+	deviceNameSpace    = "http://www.onvif.org/ver10/device/wsdl"
+	media2NameSpace    = "http://www.onvif.org/ver20/media/wsdl"
+	eventsNameSpace    = "http://www.onvif.org/ver10/events/wsdl"
+	ptzNameSpace       = "http://www.onvif.org/ver20/ptz/wsdl"
+	analyticsNameSpace = "http://www.onvif.org/ver20/analytics/wsdl"
+)
+
+// capabilityNameSpaces maps the categories of a GetCapabilities response to
+// the namespace of their service
+var capabilityNameSpaces = map[string]string{
+	"Device":    deviceNameSpace,
+	"Media":     mediaNameSpace,
+	"Imaging":   imageingNameSpace,
+	"Events":    eventsNameSpace,
+	"PTZ":       ptzNameSpace,
+	"Analytics": analyticsNameSpace,
+}
+
+// deviceServices serializes the lookup of Device.Services
+type deviceServices struct {
+	mu sync.Mutex
+	// capabilities is set once the XAddrs of GetCapabilities were merged
+	// into Device.Services
+	capabilities bool
+}
+
+// serviceXAddr returns the address of the service with the given namespace.
+// Services are fetched with GetServices on first use, and the services it
+// does not list are looked up with GetCapabilities.
+func (device *Device) serviceXAddr(ctx context.Context, nameSpace string) (string, error) {
+	lock := &device.state().services
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	services := device.Services
+	if len(services) == 0 {
+		list, err := device.getServices(ctx)
+		if err != nil {
+			Debugf("GetServices failed on %s, falling back to GetCapabilities: %v", device.XAddr, err)
+		}
+		services = make(map[string]Service)
+		for _, service := range list {
+			services[service.NameSpace] = service
+		}
+		lock.capabilities = false
+	}
+
+	// Devices may list only part of their services, such as Profile S
+	// devices without media2 or imaging entries
+	service, ok := services[nameSpace]
+	var err error
+	if (!ok || service.XAddr == "") && !lock.capabilities {
+		err = device.mergeCapabilities(ctx, services)
+		if err == nil {
+			lock.capabilities = true
+			service, ok = services[nameSpace]
+		}
+	}
+
+	// An empty list is not kept, so it is fetched again
+	if len(services) > 0 {
+		device.Services = services
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !ok || service.XAddr == "" {
+		return "", fmt.Errorf("%w: %s", ErrServiceNotSupported, nameSpace)
+	}
+
+	return service.XAddr, nil
+}
+
+// mergeCapabilities adds the XAddrs returned by GetCapabilities to the
+// services missing from services
+func (device *Device) mergeCapabilities(ctx context.Context, services map[string]Service) error {
+	// Create SOAP
+	soap := SOAP{
+		Request:  getCapabilities{Category: "All"},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	var response getCapabilitiesResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
+	if err != nil {
+		return err
+	}
+
+	// Use the XAddr of each category
+	for category, xaddr := range response.Capabilities.xaddrs() {
+		nameSpace, ok := capabilityNameSpaces[category]
+		xaddr = strings.TrimSpace(xaddr)
+		if !ok || xaddr == "" || services[nameSpace].XAddr != "" {
+			continue
+		}
+		services[nameSpace] = Service{NameSpace: nameSpace, XAddr: xaddr}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServiceXAddrCapabilitiesFallback(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		switch {
+		case strings.Contains(string(body), "GetServices"):
+			w.WriteHeader(400)
+			w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body><s:Fault>
+<s:Code><s:Value>s:Receiver</s:Value><s:Subcode><s:Value>ter:ActionNotSupported</s:Value></s:Subcode></s:Code>
+<s:Reason><s:Text>Not supported</s:Text></s:Reason></s:Fault></s:Body></s:Envelope>`))
+		case strings.Contains(string(body), "GetCapabilities"):
+			w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetCapabilitiesResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><Capabilities>
+<Device><XAddr>` + server.URL + `/onvif/device_service</XAddr></Device>
+<Media><XAddr>` + server.URL + `/cgi/media</XAddr></Media>
+</Capabilities></GetCapabilitiesResponse></s:Body></s:Envelope>`))
+		case r.URL.Path == "/cgi/media":
+			w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetStreamUriResponse xmlns="http://www.onvif.org/ver10/media/wsdl"><MediaUri><Uri>rtsp://cam/stream1</Uri></MediaUri></GetStreamUriResponse>
+</s:Body></s:Envelope>`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	device := Device{XAddr: server.URL + "/onvif/device_service"}
+
+	uri, err := device.GetStreamURI("Profile_1", "RTSP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.URI != "rtsp://cam/stream1" {
+		t.Errorf("unexpected stream URI %+v", uri)
+	}
+
+	_, err = device.GetImagingSettings("VideoSource_1")
+	if !errors.Is(err, ErrServiceNotSupported) {
+		t.Errorf("expected ErrServiceNotSupported, got %v", err)
+	}
+}
+
+func TestServiceXAddrPartialServices(t *testing.T) {
+	var getServices, getCapabilities int
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		switch {
+		case strings.Contains(string(body), "GetServices"):
+			getServices++
+			w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetServicesResponse xmlns="http://www.onvif.org/ver10/device/wsdl">
+<Service><Namespace>http://www.onvif.org/ver10/device/wsdl</Namespace><XAddr>` + server.URL + `/onvif/device_service</XAddr></Service>
+</GetServicesResponse></s:Body></s:Envelope>`))
+		case strings.Contains(string(body), "GetCapabilities"):
+			getCapabilities++
+			w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetCapabilitiesResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><Capabilities>
+<Media><XAddr>` + server.URL + `/cgi/media</XAddr></Media>
+</Capabilities></GetCapabilitiesResponse></s:Body></s:Envelope>`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	device := Device{XAddr: server.URL + "/onvif/device_service"}
+	ctx := context.Background()
+
+	xaddr, err := device.serviceXAddr(ctx, mediaNameSpace)
+	if err != nil || xaddr != server.URL+"/cgi/media" {
+		t.Errorf("unexpected media XAddr %q, %v", xaddr, err)
+	}
+	if _, err = device.serviceXAddr(ctx, imageingNameSpace); !errors.Is(err, ErrServiceNotSupported) {
+		t.Errorf("expected ErrServiceNotSupported, got %v", err)
+	}
+	if getServices != 1 || getCapabilities != 1 {
+		t.Errorf("expected one GetServices and one GetCapabilities, got %d and %d", getServices, getCapabilities)
+	}
+}
+
+func TestServiceXAddrEmptyServices(t *testing.T) {
+	getServices := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), "GetServices") {
+			w.WriteHeader(500)
+			return
+		}
+		getServices++
+		w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>
+<GetServicesResponse xmlns="http://www.onvif.org/ver10/device/wsdl"/></s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	// An empty list is fetched again on the next lookup
+	device := Device{XAddr: server.URL}
+	for i := 0; i < 2; i++ {
+		if _, err := device.serviceXAddr(context.Background(), mediaNameSpace); err == nil {
+			t.Error("expected an error")
+		}
+	}
+	if getServices != 2 || device.Services != nil {
+		t.Errorf("empty services were cached: %d GetServices, %v", getServices, device.Services)
+	}
+}
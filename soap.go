@@ -1,17 +1,14 @@
 package onvif
 
 import (
-	"bytes"
-	"crypto/md5"
+	"context"
 	"crypto/sha1"
 	"encoding/base64"
-	"encoding/hex"
+	"encoding/xml"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
 	"time"
 
@@ -19,139 +16,143 @@ import (
 	uuid "github.com/gofrs/uuid"
 )
 
-var httpClient = &http.Client{Timeout: time.Second * 5}
-
 // SOAP contains data for SOAP request
 type SOAP struct {
-	Body     string
-	XMLNs    []string
+	// Request is marshalled with encoding/xml as the body
+	Request  interface{}
 	User     string
 	Password string
 	TokenAge time.Duration
-	//authHeaders func(method string) []string
-	AuthHeaders string
-	URI         string
-	Method      string
+	// AuthMode selects how User and Password are sent
+	AuthMode AuthMode
+	// Client sends the HTTP requests, a client with DefaultTimeout when nil
+	Client *http.Client
+
+	// auth answers HTTP authentication challenges, shared by the requests
+	// of a device so its cached challenge is reused
+	auth *httpAuth
+	// attachment is sent with the request as an MTOM package when not nil
+	attachment *soapAttachment
+	// progress reports the upload of the request when not nil
+	progress func(sent, total int64)
 }
 
 // SendRequest sends SOAP request to xAddr
 func (soap *SOAP) SendRequest(xaddr string) (mxj.Map, error) {
-	// Create SOAP request
-	request := soap.createRequest()
+	return soap.SendRequestWithContext(context.Background(), xaddr)
+}
 
-	// Make sure URL valid and add authentication in xAddr
-	urlXAddr, err := url.Parse(xaddr)
+// SendRequestWithContext sends SOAP request to xAddr. The request is
+// aborted when ctx is cancelled or its deadline expires.
+func (soap *SOAP) SendRequestWithContext(ctx context.Context, xaddr string) (mxj.Map, error) {
+	responseBody, err := soap.send(ctx, xaddr)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create HTTP request
-	buffer := bytes.NewBuffer([]byte(request))
-	req, err := http.NewRequest("POST", urlXAddr.String(), buffer)
-	req.Header.Set("Content-Type", "application/soap+xml")
-	req.Header.Set("Charset", "utf-8")
-
-	Debugf("[>>>%s]%s", xaddr, buffer.String())
-	// Send request
-	resp, err := httpClient.Do(req)
+	// Parse XML to map
+	mapXML, err := mxj.NewMapXml(responseBody)
 	if err != nil {
 		Error(err)
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Read response body
-	responseBody, err := ioutil.ReadAll(resp.Body)
+	return mapXML, nil
+}
+
+// send sends SOAP request to xAddr and returns the body of a successful
+// response
+func (soap *SOAP) send(ctx context.Context, xaddr string) ([]byte, error) {
+	// Create SOAP request
+	request, err := soap.createRequest()
 	if err != nil {
-		Error(err)
 		return nil, err
 	}
-	Debugf("[<<<%s]%s", xaddr, string(responseBody))
 
-	if resp.StatusCode != 200 {
+	// Make sure URL valid and add authentication in xAddr
+	urlXAddr, err := url.Parse(xaddr)
+	if err != nil {
+		return nil, err
+	}
 
-		if resp.StatusCode == 401 {
-			fmt.Println("handle401")
-			err = soap.handle401(resp)
-			if err != nil {
-				Error(err)
-				return nil, err
-			} else {
-
-				buffer = bytes.NewBuffer([]byte(request))
-				req, err = http.NewRequest("POST", urlXAddr.String(), buffer)
-				req.Header.Set("Content-Type", "application/soap+xml")
-				req.Header.Set("Charset", "utf-8")
-				req.Header.Set("Authorization", string(soap.AuthHeaders))
-				// Send request
-				resp, err = httpClient.Do(req)
-				if err != nil {
-					Error(err)
-					return nil, err
-				}
-				defer resp.Body.Close()
-
-				if resp.StatusCode != 200 {
-					err = errors.New(resp.Status)
-					Error(err)
-					return nil, err
-				}
-
-			}
+	client := soap.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
 
-		} else {
+	auth := soap.auth
+	if auth == nil {
+		auth = &httpAuth{}
+	}
 
-			err = errors.New(resp.Status)
-			Error(err)
+	header := http.Header{}
+	header.Set("Content-Type", "application/soap+xml")
+	header.Set("Charset", "utf-8")
+
+	body := []byte(request)
+	if soap.attachment != nil {
+		var contentType string
+		body, contentType, err = soap.attachment.pack(request)
+		if err != nil {
 			return nil, err
 		}
+		header.Set("Content-Type", contentType)
 	}
 
-	// Parse XML to map
-	mapXML, err := mxj.NewMapXml(responseBody)
+	// HTTP challenges are left unanswered when the mode does not use them
+	user, password := soap.User, soap.Password
+	if !soap.AuthMode.usesHTTP() {
+		user, password = "", ""
+	}
+
+	Debugf("[>>>%s]%s", xaddr, request)
+	// Send request
+	resp, responseBody, err := auth.do(ctx, client, "POST", urlXAddr.String(), header, body, user, password, soap.progress)
 	if err != nil {
 		Error(err)
 		return nil, err
 	}
-	//fmt.Println(mapXML)
+	Debugf("[<<<%s]%s", xaddr, string(responseBody))
 
-	// Check if SOAP returns fault
-	fault, _ := mapXML.ValueForPathString("Envelope.Body.Fault.Reason.Text.#text")
-	if fault != "" {
-		return nil, errors.New(fault)
+	// Check if SOAP returns fault, devices usually send them with status 400 or 500
+	if fault := parseFault(responseBody); fault != nil {
+		fault.StatusCode = resp.StatusCode
+		return nil, fault
 	}
 
-	return mapXML, nil
+	if resp.StatusCode != 200 {
+		if resp.StatusCode == 401 {
+			err = fmt.Errorf("%s: %w", resp.Status, ErrNotAuthorized)
+		} else {
+			err = errors.New(resp.Status)
+		}
+		Error(err)
+		return nil, err
+	}
+
+	return responseBody, nil
 }
 
-func (soap SOAP) createRequest() string {
+func (soap SOAP) createRequest() (string, error) {
 	// Create request envelope
 	request := `<?xml version="1.0" encoding="UTF-8"?>`
 	request += `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">`
 
 	// Set request header
-	if soap.User != "" {
+	if soap.User != "" && soap.AuthMode.usesWSSecurity() {
 		request += "<s:Header>" + soap.createUserToken() + "</s:Header>"
 	}
 
 	// Set request body
-	//Set XML namespace
-	request += "<s:Body"
-	for _, namespace := range soap.XMLNs {
-		request += " " + namespace
+	body, err := xml.Marshal(soap.Request)
+	if err != nil {
+		return "", err
 	}
-	request += ">"
-
-	request += soap.Body + "</s:Body>"
 
 	// Close request envelope
-	request += "</s:Envelope>"
+	request += "<s:Body>" + string(body) + "</s:Body></s:Envelope>"
 
-	// Clean request
-	request = regexp.MustCompile(`\>\s+\<`).ReplaceAllString(request, "><")
-	request = regexp.MustCompile(`\s+`).ReplaceAllString(request, " ")
-
-	return request
+	return request, nil
 }
 
 func (soap SOAP) createUserToken() string {
@@ -163,106 +164,33 @@ func (soap SOAP) createUserToken() string {
 
 	nonce64 := base64.StdEncoding.EncodeToString(nonce)
 	timestamp := time.Now().Add(soap.TokenAge).UTC().Format(time.RFC3339)
-	token := string(nonce) + timestamp + soap.Password
 
-	sha := sha1.New()
-	sha.Write([]byte(token))
-	shaToken := sha.Sum(nil)
-	shaDigest64 := base64.StdEncoding.EncodeToString(shaToken)
+	passwordType := "PasswordText"
+	password := soap.Password
+	if soap.AuthMode != AuthWSSecurityText {
+		token := string(nonce) + timestamp + soap.Password
+
+		sha := sha1.New()
+		sha.Write([]byte(token))
+		shaToken := sha.Sum(nil)
+
+		passwordType = "PasswordDigest"
+		password = base64.StdEncoding.EncodeToString(shaToken)
+	}
 
 	return `<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
   		<UsernameToken>
-    		<Username>` + soap.User + `</Username>
-    		<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">` + shaDigest64 + `</Password>
+    		<Username>` + escapeXML(soap.User) + `</Username>
+    		<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#` + passwordType + `">` + escapeXML(password) + `</Password>
     		<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">` + nonce64 + `</Nonce>
     		<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">` + timestamp + `</Created>
 		</UsernameToken>
 	</Security>`
 }
 
-func md5hash(s string) string {
-	h := md5.Sum([]byte(s))
-	return hex.EncodeToString(h[:])
-}
-func (soap *SOAP) handle401(res *http.Response) (err error) {
-	authval := res.Header.Get("WWW-Authenticate")
-	hdrval := strings.SplitN(authval, " ", 2)
-	fmt.Println("hdrval:", hdrval)
-	var realm, qop, nonce string
-
-	if len(hdrval) == 2 {
-		for _, field := range strings.Split(hdrval[1], ",") {
-			field = strings.Trim(field, ", ")
-			if keyval := strings.Split(field, "="); len(keyval) == 2 {
-				key := keyval[0]
-				val := strings.Trim(keyval[1], `"`)
-				switch key {
-				case "realm":
-					realm = val
-				case "nonce":
-					nonce = val
-				case "qop":
-					qop = val
-				}
-			}
-		}
-
-		fmt.Println("realm,nonce,qop", realm, nonce, qop)
-
-		if realm != "" {
-			var username string
-			var password string
-
-			if soap.User == "" {
-				err = fmt.Errorf("no username")
-				return
-			}
-			username = soap.User
-			password = soap.Password
-
-			soap.AuthHeaders = fmt.Sprintf(`Basic %s`, base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
-
-			if nonce != "" {
-				var response string
-				var id uuid.UUID
-
-				id, err = uuid.NewV4()
-				if err != nil {
-					return
-				}
-
-				cnonce := md5hash(string(id.Bytes()))
-				fmt.Println("cnonce:", cnonce)
-
-				nc := "00000001"
-				a1 := username + ":" + realm + ":" + password
-
-				a2 := soap.Method + ":" + soap.URI
-				hs1 := md5hash(a1)
-
-				switch qop {
-				case "auth-int":
-					hs2 := md5hash(a2 + ":" + md5hash("entityBody"))
-					response = md5hash(hs1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + hs2)
-				case "auth":
-					hs2 := md5hash(a2)
-					response = md5hash(hs1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + hs2)
-				default:
-					hs2 := md5hash(a2)
-					response = md5hash(hs1 + ":" + nonce + ":" + hs2)
-				}
-
-				soap.AuthHeaders = fmt.Sprintf(
-					`Digest username="%s", realm="%s", qop="%s", algorithm="MD5", uri="%s", nonce="%s", nc=%s, cnonce="%s", opaque="", response="%s"`,
-					username, realm, qop, soap.URI, nonce, nc, cnonce, response)
-
-			}
-
-		}
-		//fmt.Println("soap.AuthHeaders:", soap.AuthHeaders)
-
-	} else {
-		Error("no username")
-	}
-	return
+// escapeXML escapes s for use as XML character data
+func escapeXML(s string) string {
+	var buffer strings.Builder
+	xml.EscapeText(&buffer, []byte(s))
+	return buffer.String()
 }
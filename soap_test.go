@@ -0,0 +1,32 @@
+package onvif
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendRequestWithContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	soap := SOAP{Request: getDeviceInformation{}}
+
+	start := time.Now()
+	_, err := soap.SendRequestWithContext(ctx, server.URL)
+	if err == nil {
+		t.Fatal("expected error from cancelled request")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request was not aborted by context, took %s", elapsed)
+	}
+}
@@ -0,0 +1,135 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// FactoryDefault is the extent of a factory reset
+type FactoryDefault string
+
+const (
+	// FactoryDefaultHard resets every setting, including the network
+	// settings, so the camera may come back with another address
+	FactoryDefaultHard FactoryDefault = "Hard"
+	// FactoryDefaultSoft resets the settings but keeps the network
+	// settings
+	FactoryDefaultSoft FactoryDefault = "Soft"
+)
+
+// DefaultReadyPollInterval is the interval between two polls of
+// WaitForReboot when none is given
+const DefaultReadyPollInterval = 2 * time.Second
+
+// SystemReboot reboots an ONVIF camera and returns its reboot message, which
+// usually tells how long the reboot takes
+func (device *Device) SystemReboot() (string, error) {
+	return device.SystemRebootWithContext(context.Background())
+}
+
+// SystemRebootWithContext is the context-aware variant of SystemReboot.
+func (device *Device) SystemRebootWithContext(ctx context.Context) (string, error) {
+	// Create SOAP
+	soap := SOAP{
+		Request:  systemReboot{},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	var response systemRebootResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
+	if err != nil {
+		return "", err
+	}
+
+	return response.Message, nil
+}
+
+// SetSystemFactoryDefault resets the settings of an ONVIF camera, which then
+// reboots
+func (device *Device) SetSystemFactoryDefault(kind FactoryDefault) error {
+	return device.SetSystemFactoryDefaultWithContext(context.Background(), kind)
+}
+
+// SetSystemFactoryDefaultWithContext is the context-aware variant of SetSystemFactoryDefault.
+func (device *Device) SetSystemFactoryDefaultWithContext(ctx context.Context, kind FactoryDefault) error {
+	// Create SOAP
+	soap := SOAP{
+		Request:  setSystemFactoryDefault{FactoryDefault: kind},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	return device.sendSOAP(ctx, soap, device.XAddr, nil)
+}
+
+// RebootAndWait reboots an ONVIF camera and waits for it to be ready again,
+// as WaitForReboot does. It returns the reboot message of the camera and how
+// long it was unavailable.
+func (device *Device) RebootAndWait(ctx context.Context, interval time.Duration) (string, time.Duration, error) {
+	message, err := device.SystemRebootWithContext(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+
+	outage, err := device.WaitForReboot(ctx, interval)
+	return message, outage, err
+}
+
+// WaitForReboot polls an ONVIF camera every interval, or every
+// DefaultReadyPollInterval when zero, until it stops answering and is then
+// ready again. The camera is ready when GetSystemDateAndTime and
+// GetInformation both succeed. It returns how long the camera was
+// unavailable, from the last poll answered before the reboot. ctx should
+// have a deadline: ErrRebootNotObserved is returned when the camera answered
+// every poll until ctx is done, and the error of ctx when it did not come
+// back.
+func (device *Device) WaitForReboot(ctx context.Context, interval time.Duration) (time.Duration, error) {
+	if interval <= 0 {
+		interval = DefaultReadyPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastReady := time.Now()
+	down := false
+	for {
+		err := device.ready(ctx)
+		switch {
+		case err == nil && down:
+			return time.Since(lastReady), nil
+		case err == nil:
+			lastReady = time.Now()
+		case ctx.Err() == nil:
+			if !down {
+				log.Debugf("%s stopped answering: %v", device.XAddr, err)
+			}
+			down = true
+		}
+
+		select {
+		case <-ctx.Done():
+			if !down {
+				return 0, fmt.Errorf("%s: %w", device.XAddr, ErrRebootNotObserved)
+			}
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ready tells whether the camera answers both unauthenticated and
+// authenticated requests
+func (device *Device) ready(ctx context.Context) error {
+	if _, err := device.GetSystemDateAndTimeWithContext(ctx); err != nil {
+		return err
+	}
+	_, err := device.GetInformationWithContext(ctx)
+	return err
+}
@@ -0,0 +1,107 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rebootingServer is a camera which keeps answering for one poll after a
+// reboot request, then is down for two polls
+func rebootingServer(t *testing.T) *httptest.Server {
+	var mutex sync.Mutex
+	rebooting := false
+	polls := 0
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		var response string
+		switch {
+		case strings.Contains(string(body), "SystemReboot"):
+			rebooting = true
+			response = `<SystemRebootResponse xmlns="http://www.onvif.org/ver10/device/wsdl">
+<Message>Rebooting in 30 seconds</Message></SystemRebootResponse>`
+		case strings.Contains(string(body), "GetSystemDateAndTime"):
+			if rebooting {
+				polls++
+				if polls == 2 || polls == 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+			}
+			now := time.Now().UTC()
+			response = fmt.Sprintf(`<GetSystemDateAndTimeResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><SystemDateAndTime>
+<DateTimeType>NTP</DateTimeType><UTCDateTime><Time><Hour>%d</Hour><Minute>%d</Minute><Second>%d</Second></Time>
+<Date><Year>%d</Year><Month>%d</Month><Day>%d</Day></Date></UTCDateTime>
+</SystemDateAndTime></GetSystemDateAndTimeResponse>`, now.Hour(), now.Minute(), now.Second(), now.Year(), now.Month(), now.Day())
+		case strings.Contains(string(body), "GetDeviceInformation"):
+			response = `<GetDeviceInformationResponse xmlns="http://www.onvif.org/ver10/device/wsdl">
+<Manufacturer>Acme</Manufacturer><Model>C1</Model><FirmwareVersion>1.0</FirmwareVersion></GetDeviceInformationResponse>`
+		default:
+			t.Errorf("unexpected request %s", body)
+		}
+		w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>` + response + `</s:Body></s:Envelope>`))
+	}))
+}
+
+func TestRebootAndWait(t *testing.T) {
+	server := rebootingServer(t)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	device := Device{XAddr: server.URL}
+	start := time.Now()
+	message, outage, err := device.RebootAndWait(ctx, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message != "Rebooting in 30 seconds" {
+		t.Errorf("unexpected reboot message %q", message)
+	}
+	// Down for two polls, between the first and fourth ones
+	if outage < 40*time.Millisecond || outage > time.Since(start) {
+		t.Errorf("unexpected outage %v", outage)
+	}
+}
+
+func TestWaitForRebootNotObserved(t *testing.T) {
+	server := rebootingServer(t)
+	defer server.Close()
+
+	// The camera never goes down without a reboot request
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	device := Device{XAddr: server.URL}
+	if _, err := device.WaitForReboot(ctx, 20*time.Millisecond); !errors.Is(err, ErrRebootNotObserved) {
+		t.Errorf("expected ErrRebootNotObserved, got %v", err)
+	}
+}
+
+func TestWaitForRebootDeadline(t *testing.T) {
+	// The camera never comes back
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	device := Device{XAddr: server.URL}
+	if _, err := device.WaitForReboot(ctx, 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+}
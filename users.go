@@ -0,0 +1,149 @@
+package onvif
+
+import (
+	"context"
+	"strings"
+)
+
+// UserLevel is the access level of a user account
+type UserLevel string
+
+const (
+	// UserLevelAdministrator can change the security settings and accounts
+	UserLevelAdministrator UserLevel = "Administrator"
+	// UserLevelOperator can change the configuration of the device
+	UserLevelOperator UserLevel = "Operator"
+	// UserLevelUser can read the configuration and the media streams
+	UserLevelUser UserLevel = "User"
+	// UserLevelAnonymous is the level of unauthenticated access
+	UserLevelAnonymous UserLevel = "Anonymous"
+)
+
+// User is a user account of an ONVIF camera. Password is never returned by
+// GetUsers.
+type User struct {
+	Username  string
+	Password  string
+	UserLevel UserLevel
+}
+
+// GetUsers fetches the user accounts of an ONVIF camera
+func (device *Device) GetUsers() ([]User, error) {
+	return device.GetUsersWithContext(context.Background())
+}
+
+// GetUsersWithContext is the context-aware variant of GetUsers.
+func (device *Device) GetUsersWithContext(ctx context.Context) ([]User, error) {
+	// Create SOAP
+	soap := SOAP{
+		Request:  getUsers{},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	var response getUsersResponse
+	err := device.sendSOAP(ctx, soap, device.XAddr, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []User{}
+	for _, user := range response.User {
+		if user.Username == "" {
+			return nil, errMissing("GetUsers", "Username")
+		}
+		users = append(users, User{
+			Username:  strings.TrimSpace(user.Username),
+			UserLevel: UserLevel(strings.TrimSpace(user.UserLevel)),
+		})
+	}
+
+	return users, nil
+}
+
+// CreateUsers creates user accounts on an ONVIF camera. The password policy
+// faults of the camera are matched by ErrUsernameClash, ErrUsernameTooShort,
+// ErrUsernameTooLong, ErrPasswordTooWeak, ErrPasswordTooLong,
+// ErrTooManyUsers and ErrAnonymousNotAllowed.
+func (device *Device) CreateUsers(users []User) error {
+	return device.CreateUsersWithContext(context.Background(), users)
+}
+
+// CreateUsersWithContext is the context-aware variant of CreateUsers.
+func (device *Device) CreateUsersWithContext(ctx context.Context, users []User) error {
+	// Create SOAP
+	soap := SOAP{
+		Request:  createUsers{User: userRequests(users)},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	return device.sendSOAP(ctx, soap, device.XAddr, nil)
+}
+
+// DeleteUsers deletes user accounts of an ONVIF camera. ErrFixedUser is
+// matched when an account can not be deleted, and ErrUsernameMissing when
+// it does not exist.
+func (device *Device) DeleteUsers(usernames []string) error {
+	return device.DeleteUsersWithContext(context.Background(), usernames)
+}
+
+// DeleteUsersWithContext is the context-aware variant of DeleteUsers.
+func (device *Device) DeleteUsersWithContext(ctx context.Context, usernames []string) error {
+	// Create SOAP
+	soap := SOAP{
+		Request:  deleteUsers{Username: usernames},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	return device.sendSOAP(ctx, soap, device.XAddr, nil)
+}
+
+// SetUser updates the password and level of user accounts of an ONVIF
+// camera. The password of the device is updated when the account it uses
+// changes its password, so the next requests succeed. The faults of the
+// camera are matched as for CreateUsers, and by ErrFixedUser and
+// ErrUsernameMissing.
+func (device *Device) SetUser(users []User) error {
+	return device.SetUserWithContext(context.Background(), users)
+}
+
+// SetUserWithContext is the context-aware variant of SetUser.
+func (device *Device) SetUserWithContext(ctx context.Context, users []User) error {
+	// Create SOAP
+	soap := SOAP{
+		Request:  setUser{User: userRequests(users)},
+		User:     device.User,
+		Password: device.Password,
+	}
+
+	// Send SOAP request
+	err := device.sendSOAP(ctx, soap, device.XAddr, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if user.Username == device.User && user.Password != "" {
+			device.Password = user.Password
+		}
+	}
+	return nil
+}
+
+// userRequests converts users to the elements of a request
+func userRequests(users []User) []userRequest {
+	requests := make([]userRequest, 0, len(users))
+	for _, user := range users {
+		requests = append(requests, userRequest{
+			Username:  user.Username,
+			Password:  user.Password,
+			UserLevel: string(user.UserLevel),
+		})
+	}
+	return requests
+}
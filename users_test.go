@@ -0,0 +1,93 @@
+package onvif
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const weakPasswordFault = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:ter="http://www.onvif.org/ver10/error">
+<env:Body><env:Fault>
+	<env:Code><env:Value>env:Sender</env:Value>
+		<env:Subcode><env:Value>ter:OperationProhibited</env:Value>
+			<env:Subcode><env:Value>ter:Password</env:Value></env:Subcode>
+		</env:Subcode>
+	</env:Code>
+	<env:Reason><env:Text xml:lang="en">Too weak password</env:Text></env:Reason>
+</env:Fault></env:Body></env:Envelope>`
+
+func TestUsers(t *testing.T) {
+	var setUser []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var response string
+		switch {
+		case strings.Contains(string(body), "GetUsers"):
+			response = `<GetUsersResponse xmlns="http://www.onvif.org/ver10/device/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<User><tt:Username>admin</tt:Username><tt:UserLevel>Administrator</tt:UserLevel></User>
+<User><tt:Username>viewer</tt:Username><tt:UserLevel>User</tt:UserLevel></User>
+</GetUsersResponse>`
+		case strings.Contains(string(body), "CreateUsers"):
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(weakPasswordFault))
+			return
+		case strings.Contains(string(body), "SetUser"):
+			setUser = body
+			response = `<SetUserResponse xmlns="http://www.onvif.org/ver10/device/wsdl"/>`
+		}
+		w.Write([]byte(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>` + response + `</s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	device := Device{XAddr: server.URL, User: "admin", Password: "admin", AuthMode: AuthWSSecurityText}
+
+	users, err := device.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Username != "admin" || users[0].UserLevel != UserLevelAdministrator || users[1].UserLevel != UserLevelUser {
+		t.Errorf("unexpected users %+v", users)
+	}
+
+	err = device.CreateUsers([]User{{Username: "operator", Password: "1234", UserLevel: UserLevelOperator}})
+	if !errors.Is(err, ErrPasswordTooWeak) {
+		t.Errorf("expected ErrPasswordTooWeak, got %v", err)
+	}
+	var prohibited ErrOperationProhibited
+	if !errors.As(err, &prohibited) {
+		t.Errorf("expected ErrOperationProhibited, got %v", err)
+	}
+
+	if err = device.SetUser([]User{{Username: "admin", Password: "n3w-Secret", UserLevel: UserLevelAdministrator}}); err != nil {
+		t.Fatal(err)
+	}
+	if device.Password != "n3w-Secret" {
+		t.Errorf("device password was not updated")
+	}
+
+	var request struct {
+		Header struct {
+			Username string `xml:"Security>UsernameToken>Username"`
+			Password string `xml:"Security>UsernameToken>Password"`
+		} `xml:"Header"`
+		User []struct {
+			Username  string `xml:"http://www.onvif.org/ver10/schema Username"`
+			Password  string `xml:"http://www.onvif.org/ver10/schema Password"`
+			UserLevel string `xml:"http://www.onvif.org/ver10/schema UserLevel"`
+		} `xml:"Body>SetUser>User"`
+	}
+	if err = xml.Unmarshal(setUser, &request); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.User) != 1 || request.User[0].Password != "n3w-Secret" || request.User[0].UserLevel != "Administrator" {
+		t.Errorf("unexpected SetUser request %+v", request.User)
+	}
+	if request.Header.Password != "admin" {
+		t.Errorf("SetUser was not authenticated with the old password")
+	}
+}